@@ -0,0 +1,607 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jlmcmchl/tbc-discord-bot/stats"
+)
+
+const (
+	allselRows = 24
+	// allselHours is how long a board keeps updating if selection never
+	// finishes on TBA.
+	allselHours = 12
+
+	metricOPR   = "opr"
+	metricElo   = "elo"
+	metricScout = "scout"
+)
+
+var scoreRegex = regexp.MustCompile(`^(?:frc)?(\d+)[=:](-?\d+(?:\.\d+)?)$`)
+
+// allselUpdating is set while updateAllselBoards runs, so a slow run isn't
+// overlapped by the next one.
+var (
+	allselUpdating      bool
+	allselUpdatingMutex = &sync.Mutex{}
+)
+
+// allselEvent is everything TBA says about an event that boards use, loaded
+// once and shared by every board on the event.
+type allselEvent struct {
+	Key       string
+	Teams     []string
+	Alliances []tbaAlliance
+	Rankings  *tbaRankings
+	Matches   []tbaMatch
+	// OPR is empty until qualification matches have been played.
+	OPR map[string]float64
+}
+
+func loadAllselEvent(event string) (*allselEvent, error) {
+	teams, err := tbaEventTeamKeys(event)
+	if err == errTBANotFound || (err == nil && len(teams) == 0) {
+		return nil, commandError(fmt.Sprintf("TBA doesn't have a team list for %s.", event))
+	}
+	if err != nil {
+		return nil, err
+	}
+	e := &allselEvent{Key: event, Teams: teams, OPR: map[string]float64{}}
+	if e.Alliances, err = tbaEventAlliances(event); ignoreNotFound(err) != nil {
+		return nil, err
+	}
+	if e.Rankings, err = tbaEventRankings(event); ignoreNotFound(err) != nil {
+		return nil, err
+	}
+	if e.Matches, err = tbaEventMatches(event); ignoreNotFound(err) != nil {
+		return nil, err
+	}
+
+	ratings, err := stats.Compute(qualMatches(e.Matches))
+	if err == nil {
+		e.OPR = ratings.OPR
+	} else if err != stats.ErrNoMatches {
+		return nil, err
+	}
+	return e, nil
+}
+
+// allselBoard is a live list of available teams posted in a channel.
+type allselBoard struct {
+	Channel string
+	Event   string
+	Guild   string
+	Metric  string
+	Message string
+	Summary string
+	Created time.Time
+}
+
+// canScout reports whether someone can see or change a guild's scouting
+// data: admins and members with the scout role.
+func canScout(ctx *commandContext) bool {
+	if isAdmin(ctx.dg, ctx.msg) {
+		return true
+	}
+	if ctx.settings.ScoutRole == "" {
+		return false
+	}
+	member, err := ctx.dg.GuildMember(ctx.guild, ctx.msg.Author.ID)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	for _, role := range member.Roles {
+		if role == ctx.settings.ScoutRole {
+			return true
+		}
+	}
+	return false
+}
+
+// metricValues rates every team at an event by a board's metric. Teams
+// without a value are left out.
+func metricValues(guild, metric string, e *allselEvent) (map[string]float64, error) {
+	values := map[string]float64{}
+	switch metric {
+	case metricOPR:
+		for team, opr := range e.OPR {
+			values[team] = opr
+		}
+
+	case metricElo:
+		for _, team := range e.Teams {
+			values[team] = eloRating(team)
+		}
+
+	case metricScout:
+		rows, err := db.Query("SELECT Team, Score FROM Scouting_Scores WHERE Guild = $1 AND Event = $2", guild, e.Key)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var team string
+			var score float64
+			if err = rows.Scan(&team, &score); err != nil {
+				return nil, err
+			}
+			values[team] = score
+		}
+	}
+	return values, nil
+}
+
+// doNotPick returns a guild's do not pick list for an event, with reasons.
+func doNotPick(guild, event string) (map[string]string, error) {
+	rows, err := db.Query("SELECT Team, Reason FROM Allsel_Dnp WHERE Guild = $1 AND Event = $2", guild, event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dnp := map[string]string{}
+	for rows.Next() {
+		var team, reason string
+		if err = rows.Scan(&team, &reason); err != nil {
+			return nil, err
+		}
+		dnp[team] = reason
+	}
+	return dnp, rows.Err()
+}
+
+// allselEmbed builds a board from TBA's current alliances. It also reports
+// whether selection has finished, after which the board stops updating.
+func allselEmbed(guild, metric string, e *allselEvent) (*discordgo.MessageEmbed, bool, error) {
+	event, teams, alliances, rankings := e.Key, e.Teams, e.Alliances, e.Rankings
+	values, err := metricValues(guild, metric, e)
+	if err != nil {
+		return nil, false, err
+	}
+	dnp, err := doNotPick(guild, event)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Smaller events seat fewer than allianceCount alliances, so selection is
+	// over once every alliance TBA reports is full.
+	taken := map[string]bool{}
+	done := len(alliances) > 0
+	var picks []string
+	for i, a := range alliances {
+		for _, team := range a.Picks {
+			taken[team] = true
+		}
+		for _, team := range a.Declines {
+			taken[team] = true
+		}
+		if len(a.Picks) < 3 {
+			done = false
+		}
+
+		name := a.Name
+		if name == "" {
+			name = fmt.Sprintf("Alliance %d", i+1)
+		}
+		picks = append(picks, fmt.Sprintf("**%s**: %s", name, teamList(a.Picks)))
+	}
+	if !done && len(alliances) > 0 {
+		done = playoffsStarted(e.Matches)
+	}
+
+	rank := map[string]int{}
+	for _, r := range rankings.Rankings {
+		rank[r.TeamKey] = r.Rank
+	}
+	var available []string
+	for _, team := range teams {
+		if !taken[team] {
+			available = append(available, team)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool {
+		a, b := available[i], available[j]
+		va, okA := values[a]
+		vb, okB := values[b]
+		if okA != okB {
+			return okA
+		}
+		if okA && va != vb {
+			return va > vb
+		}
+		ra, rb := rank[a], rank[b]
+		if ra == 0 {
+			ra = math.MaxInt32
+		}
+		if rb == 0 {
+			rb = math.MaxInt32
+		}
+		if ra != rb {
+			return ra < rb
+		}
+		return a < b
+	})
+
+	shown := available
+	if len(shown) > allselRows {
+		shown = shown[:allselRows]
+	}
+	lines := []string{fmt.Sprintf("%3s %-6s %7s %4s", "#", "Team", strings.ToUpper(metric), "Rank")}
+	for i, team := range shown {
+		value, r := "-", "-"
+		if v, ok := values[team]; ok {
+			value = fmt.Sprintf("%.1f", v)
+		}
+		if rank[team] > 0 {
+			r = strconv.Itoa(rank[team])
+		}
+		line := fmt.Sprintf("%3d %-6s %7s %4s", i+1, strings.TrimPrefix(team, "frc"), value, r)
+		if _, ok := dnp[team]; ok {
+			line += " DNP"
+		}
+		lines = append(lines, line)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("%s alliance selection by %s", event, strings.ToUpper(metric)),
+		URL:         "https://www.thebluealliance.com/event/" + event + "#alliances",
+		Color:       tbaColor,
+		Description: "```\n" + strings.Join(lines, "\n") + "\n```",
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%d of %d teams available • DNP is this server's do not pick list", len(available), len(teams)),
+		},
+	}
+	if len(picks) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Alliances", Value: truncate(strings.Join(picks, "\n"), 1024)})
+	}
+	if done {
+		embed.Title += " (complete)"
+	}
+	return embed, done, nil
+}
+
+// playoffsStarted reports whether TBA has any playoff matches for an event,
+// which means alliances are final even if some are short a pick.
+func playoffsStarted(matches []tbaMatch) bool {
+	for _, m := range matches {
+		if m.CompLevel != "qm" {
+			return true
+		}
+	}
+	return false
+}
+
+// allselSummary is what changes on a board between updates.
+func allselSummary(embed *discordgo.MessageEmbed) string {
+	s := embed.Title + embed.Description
+	for _, f := range embed.Fields {
+		s += f.Value
+	}
+	return s
+}
+
+func allselStart(ctx *commandContext, event string) error {
+	if !canScout(ctx) {
+		return commandError("Only admins and the scout role can start a board.")
+	}
+	metric := metricOPR
+	if ctx.has("metric") {
+		metric = strings.ToLower(ctx.str("metric"))
+	}
+	if metric != metricOPR && metric != metricElo && metric != metricScout {
+		return commandError("The metric must be opr, elo or scout.")
+	}
+
+	e, err := loadAllselEvent(event)
+	if err != nil {
+		return err
+	}
+	embed, done, err := allselEmbed(ctx.guild, metric, e)
+	if err != nil {
+		return err
+	}
+	msg, err := ctx.replyEmbed(embed)
+	if err != nil || done {
+		return err
+	}
+
+	var old string
+	err = db.QueryRow("SELECT Message FROM Allsel_Boards WHERE Channel = $1 AND Event = $2", ctx.msg.ChannelID, event).Scan(&old)
+	if err == nil {
+		if err = ctx.dg.ChannelMessageDelete(ctx.msg.ChannelID, old); err != nil {
+			log.Println(err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO Allsel_Boards (Channel, Event, Guild, Metric, Message, Summary, Created_At) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (Channel, Event) DO UPDATE SET Guild = EXCLUDED.Guild, Metric = EXCLUDED.Metric, Message = EXCLUDED.Message,
+		Summary = EXCLUDED.Summary, Created_At = EXCLUDED.Created_At`,
+		ctx.msg.ChannelID, event, ctx.guild, metric, msg.ID, allselSummary(embed), time.Now())
+	return err
+}
+
+func allselStop(ctx *commandContext, event string) error {
+	res, err := db.Exec("DELETE FROM Allsel_Boards WHERE Channel = $1 AND Event = $2", ctx.msg.ChannelID, event)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return commandError(fmt.Sprintf("There isn't a live %s board in this channel.", event))
+	}
+	_, err = ctx.reply(fmt.Sprintf("Stopped updating the %s board.", event))
+	return err
+}
+
+// allselDnp lists the do not pick list, or adds teams to it with an optional
+// reason after them.
+func allselDnp(ctx *commandContext, event, value string) error {
+	if !canScout(ctx) {
+		return commandError("Only admins and the scout role can see or change the do not pick list.")
+	}
+	if value == "" {
+		dnp, err := doNotPick(ctx.guild, event)
+		if err != nil {
+			return err
+		}
+		if len(dnp) == 0 {
+			_, err = ctx.reply(fmt.Sprintf("This server's %s do not pick list is empty.", event))
+			return err
+		}
+
+		var teams []string
+		for team := range dnp {
+			teams = append(teams, team)
+		}
+		sort.Slice(teams, func(i, j int) bool {
+			a, _ := strconv.Atoi(strings.TrimPrefix(teams[i], "frc"))
+			b, _ := strconv.Atoi(strings.TrimPrefix(teams[j], "frc"))
+			return a < b
+		})
+		var lines []string
+		for _, team := range teams {
+			line := "**" + strings.TrimPrefix(team, "frc") + "**"
+			if dnp[team] != "" {
+				line += ": " + dnp[team]
+			}
+			lines = append(lines, line)
+		}
+		_, err = ctx.replyEmbed(&discordgo.MessageEmbed{
+			Title:       event + " do not pick",
+			Color:       tbaColor,
+			Description: truncate(strings.Join(lines, "\n"), 2048),
+		})
+		return err
+	}
+
+	var teams []string
+	fields := strings.Fields(value)
+	for len(fields) > 0 {
+		team, err := convertArg(argSpec{name: "team", kind: argTeam}, fields[0])
+		if err != nil {
+			break
+		}
+		teams = append(teams, teamKey(team.(string)))
+		fields = fields[1:]
+	}
+	if len(teams) == 0 {
+		return usageError("list the teams to add, like `allsel dnp 2019casj 254 971 reason`")
+	}
+	reason := strings.Join(fields, " ")
+
+	for _, team := range teams {
+		_, err := db.Exec(`INSERT INTO Allsel_Dnp (Guild, Event, Team, Reason, Added_By) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (Guild, Event, Team) DO UPDATE SET Reason = EXCLUDED.Reason, Added_By = EXCLUDED.Added_By`,
+			ctx.guild, event, team, reason, ctx.msg.Author.ID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ctx.reply(fmt.Sprintf("Added %s to the %s do not pick list.", teamList(teams), event))
+	return err
+}
+
+func allselUndnp(ctx *commandContext, event, value string) error {
+	if !canScout(ctx) {
+		return commandError("Only admins and the scout role can change the do not pick list.")
+	}
+
+	var removed []string
+	for _, field := range strings.Fields(value) {
+		team, err := convertArg(argSpec{name: "team", kind: argTeam}, field)
+		if err != nil {
+			return err
+		}
+		key := teamKey(team.(string))
+		res, err := db.Exec("DELETE FROM Allsel_Dnp WHERE Guild = $1 AND Event = $2 AND Team = $3", ctx.guild, event, key)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) == 0 {
+		return commandError("None of those teams are on the do not pick list.")
+	}
+	_, err := ctx.reply(fmt.Sprintf("Removed %s from the %s do not pick list.", teamList(removed), event))
+	return err
+}
+
+// allselScore sets custom scouting scores from pairs like 254=42.5, or
+// clears them all.
+func allselScore(ctx *commandContext, event, value string) error {
+	if !canScout(ctx) {
+		return commandError("Only admins and the scout role can set scouting scores.")
+	}
+
+	if strings.ToLower(value) == "clear" {
+		if _, err := db.Exec("DELETE FROM Scouting_Scores WHERE Guild = $1 AND Event = $2", ctx.guild, event); err != nil {
+			return err
+		}
+		_, err := ctx.reply(fmt.Sprintf("Cleared the %s scouting scores.", event))
+		return err
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return usageError("give scores like `allsel score 2019casj 254=42.5 971=38`")
+	}
+	for _, field := range fields {
+		match := scoreRegex.FindStringSubmatch(strings.ToLower(field))
+		if match == nil {
+			return commandError(fmt.Sprintf("%q isn't a score like 254=42.5.", field))
+		}
+		score, _ := strconv.ParseFloat(match[2], 64)
+		_, err := db.Exec(`INSERT INTO Scouting_Scores (Guild, Event, Team, Score) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (Guild, Event, Team) DO UPDATE SET Score = EXCLUDED.Score`,
+			ctx.guild, event, "frc"+match[1], score)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ctx.reply(fmt.Sprintf("Saved %d scouting scores for %s. Use `--metric scout` to rank by them.", len(fields), event))
+	return err
+}
+
+func allselCommand(ctx *commandContext) error {
+	if ctx.guild == "" {
+		return commandError("Alliance selection boards use this server's scouting data, so use this in a server channel.")
+	}
+
+	target := strings.ToLower(ctx.str("target"))
+	if eventKeyRegex.MatchString(target) {
+		if ctx.has("event") {
+			return usageError("a board only takes an event, pick the metric with --metric")
+		}
+		return allselStart(ctx, target)
+	}
+
+	if !ctx.has("event") {
+		return usageError("missing <event>")
+	}
+	raw, err := convertArg(argSpec{name: "event", kind: argEvent}, ctx.str("event"))
+	if err != nil {
+		return err
+	}
+	event := raw.(string)
+
+	switch target {
+	case "dnp":
+		return allselDnp(ctx, event, ctx.str("value"))
+	case "undnp":
+		return allselUndnp(ctx, event, ctx.str("value"))
+	case "score":
+		return allselScore(ctx, event, ctx.str("value"))
+	case "stop":
+		if !canScout(ctx) {
+			return commandError("Only admins and the scout role can stop a board.")
+		}
+		return allselStop(ctx, event)
+	}
+	return usageError(fmt.Sprintf("unknown action %q, use an event key, dnp, undnp, score or stop", target))
+}
+
+// updateAllselBoards edits live boards when TBA reports new picks or
+// declines, or scouting data changes. Boards stop once selection is complete
+// or after allselHours.
+func updateAllselBoards() {
+	dg := session
+	if dg == nil {
+		return
+	}
+
+	allselUpdatingMutex.Lock()
+	if allselUpdating {
+		allselUpdatingMutex.Unlock()
+		return
+	}
+	allselUpdating = true
+	allselUpdatingMutex.Unlock()
+	defer func() {
+		allselUpdatingMutex.Lock()
+		allselUpdating = false
+		allselUpdatingMutex.Unlock()
+	}()
+
+	rows, err := db.Query("SELECT Channel, Event, Guild, Metric, Message, Summary, Created_At FROM Allsel_Boards")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	var boards []allselBoard
+	for rows.Next() {
+		var b allselBoard
+		if err = rows.Scan(&b.Channel, &b.Event, &b.Guild, &b.Metric, &b.Message, &b.Summary, &b.Created); err != nil {
+			log.Println(err)
+			break
+		}
+		boards = append(boards, b)
+	}
+	rows.Close()
+
+	events := map[string]*allselEvent{}
+	for _, b := range boards {
+		if time.Since(b.Created) > allselHours*time.Hour {
+			if _, err = db.Exec("DELETE FROM Allsel_Boards WHERE Channel = $1 AND Event = $2", b.Channel, b.Event); err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+
+		e, ok := events[b.Event]
+		if !ok {
+			if e, err = loadAllselEvent(b.Event); err != nil {
+				log.Println(err)
+				continue
+			}
+			events[b.Event] = e
+		}
+		embed, done, err := allselEmbed(b.Guild, b.Metric, e)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if s := allselSummary(embed); s != b.Summary {
+			if _, err = dg.ChannelMessageEditEmbed(b.Channel, b.Message, embed); err != nil {
+				log.Println(err)
+				continue
+			}
+			_, err = db.Exec("UPDATE Allsel_Boards SET Summary = $3 WHERE Channel = $1 AND Event = $2", b.Channel, b.Event, s)
+		}
+		if done {
+			_, err = db.Exec("DELETE FROM Allsel_Boards WHERE Channel = $1 AND Event = $2", b.Channel, b.Event)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "allsel",
+		aliases: []string{"selection"},
+		summary: "Run a live available-teams board during alliance selection.",
+		help: "`allsel 2019casj` posts the teams still available, ranked by --metric opr, elo or scout, and updates it as TBA " +
+			"reports picks and declines. `allsel dnp 2019casj [teams reason]` shows or adds to this server's do not pick list, " +
+			"`allsel undnp 2019casj <teams>` removes teams, `allsel score 2019casj 254=42.5 ...` sets scout scores and " +
+			"`allsel stop 2019casj` stops the board. Boards and the do not pick list are only for admins and the scout-role from config, " +
+			"since they show this server's scouting data.",
+		args: []argSpec{
+			{name: "target"},
+			{name: "event", optional: true},
+			{name: "value", kind: argText, optional: true},
+		},
+		flags: []argSpec{{name: "metric"}},
+		run:   allselCommand,
+	})
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// awardsIndexTTL is how long the current season's award index is used
+	// before it is rebuilt.
+	awardsIndexTTL = 24 * time.Hour
+	// awardsFirstYear is the first season TBA has awards for.
+	awardsFirstYear = 1992
+)
+
+var (
+	// awardsIndexing holds the seasons being indexed, so a season is never
+	// indexed twice at once.
+	awardsIndexing = map[int]bool{}
+	awardsMutex    = &sync.Mutex{}
+)
+
+// awardTypeNames maps the names people use for awards to TBA award types.
+// Anything else is matched against the award's name.
+var awardTypeNames = map[string]int{
+	"impact":                awardChairmans,
+	"chairmans":             awardChairmans,
+	"impact-finalist":       awardChairmansFinalist,
+	"winner":                awardWinner,
+	"finalist":              awardFinalist,
+	"woodie":                awardWoodieFlowers,
+	"wfa":                   awardWoodieFlowers,
+	"deans":                 awardDeansList,
+	"volunteer":             awardVolunteer,
+	"ei":                    awardEngineeringInspiration,
+	"ras":                   awardRookieAllStar,
+	"gp":                    11,
+	"judges":                13,
+	"hrs":                   14,
+	"rookie-inspiration":    15,
+	"industrial-design":     16,
+	"quality":               17,
+	"safety":                18,
+	"sportsmanship":         19,
+	"creativity":            20,
+	"engineering":           21,
+	"entrepreneurship":      22,
+	"imagery":               27,
+	"innovation-in-control": 29,
+	"spirit":                30,
+	"autonomous":            71,
+}
+
+// awardFilter narrows down an award search.
+type awardFilter struct {
+	awardType int
+	name      string
+	year      int
+	event     string
+	events    map[string]bool
+}
+
+func (f *awardFilter) matches(award *tbaAward) bool {
+	switch {
+	case f.awardType >= 0 && award.AwardType != f.awardType:
+		return false
+	case f.name != "" && !strings.Contains(strings.ToLower(award.Name), f.name):
+		return false
+	case f.year != 0 && award.Year != f.year:
+		return false
+	case f.event != "" && award.EventKey != f.event:
+		return false
+	case f.events != nil && !f.events[award.EventKey]:
+		return false
+	}
+	return true
+}
+
+// indexAwards stores every award of a season, so searches across events
+// don't need hundreds of TBA requests.
+// Every event's awards are fetched before the transaction starts, so it is
+// only open while rows are written.
+func indexAwards(year int) error {
+	awardsMutex.Lock()
+	if awardsIndexing[year] {
+		awardsMutex.Unlock()
+		return nil
+	}
+	awardsIndexing[year] = true
+	awardsMutex.Unlock()
+	defer func() {
+		awardsMutex.Lock()
+		delete(awardsIndexing, year)
+		awardsMutex.Unlock()
+	}()
+
+	events, err := tbaEventsSimple(year)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+
+	type eventAwards struct {
+		key, district string
+		awards        []tbaAward
+	}
+	var fetched []eventAwards
+	for i := range events {
+		e := &events[i]
+		awards, err := tbaEventAwards(e.Key)
+		if err = ignoreNotFound(err); err != nil {
+			return err
+		}
+		district := ""
+		if e.District != nil {
+			district = e.District.Abbreviation
+		}
+		fetched = append(fetched, eventAwards{e.Key, district, awards})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM Awards WHERE Year = $1", year); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, e := range fetched {
+		for _, award := range e.awards {
+			for _, recipient := range award.RecipientList {
+				_, err = tx.Exec(`INSERT INTO Awards (Year, Event, District, Award_Type, Name, Team, Awardee)
+					VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING`,
+					year, e.key, e.district, award.AwardType, award.Name, recipient.TeamKey, recipient.Awardee)
+				if err != nil {
+					tx.Rollback()
+					return err
+				}
+			}
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO Award_Years (Year, Indexed_At) VALUES ($1, $2)
+		ON CONFLICT (Year) DO UPDATE SET Indexed_At = $2`, year, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// awardsIndexed reports whether a season's index can be used as is. Seasons
+// indexed after they ended never change.
+func awardsIndexed(year int) (bool, error) {
+	var indexed time.Time
+	err := db.QueryRow("SELECT Indexed_At FROM Award_Years WHERE Year = $1", year).Scan(&indexed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return indexed.Year() > year || time.Since(indexed) < awardsIndexTTL, nil
+}
+
+// indexAwardSeasons indexes every season that is missing from the index or,
+// for the current season, out of date. It runs from cron.
+func indexAwardSeasons() {
+	for year := awardsFirstYear; year <= time.Now().Year(); year++ {
+		indexed, err := awardsIndexed(year)
+		if err == nil && !indexed {
+			err = indexAwards(year)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// searchAwards queries the index, for one season or every indexed season
+// when the filter has no year.
+func searchAwards(f *awardFilter, district string) ([]tbaAward, error) {
+	query := "SELECT Year, Event, Award_Type, Name, Team, Awardee FROM Awards WHERE TRUE"
+	var args []interface{}
+	if f.year != 0 {
+		args = append(args, f.year)
+		query += fmt.Sprintf(" AND Year = $%d", len(args))
+	}
+	if f.awardType >= 0 {
+		args = append(args, f.awardType)
+		query += fmt.Sprintf(" AND Award_Type = $%d", len(args))
+	}
+	if f.name != "" {
+		args = append(args, "%"+f.name+"%")
+		query += fmt.Sprintf(" AND Name ILIKE $%d", len(args))
+	}
+	if district != "" {
+		args = append(args, district)
+		query += fmt.Sprintf(" AND District = $%d", len(args))
+	}
+	query += " ORDER BY Year DESC, Event, Award_Type, Team"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var awards []tbaAward
+	for rows.Next() {
+		var award tbaAward
+		var recipient tbaAwardRecipient
+		err = rows.Scan(&award.Year, &award.EventKey, &award.AwardType, &award.Name, &recipient.TeamKey, &recipient.Awardee)
+		if err != nil {
+			return nil, err
+		}
+		award.RecipientList = []tbaAwardRecipient{recipient}
+		awards = append(awards, award)
+	}
+	return awards, rows.Err()
+}
+
+func awardLine(award *tbaAward, showTeams bool) string {
+	line := fmt.Sprintf("%d **%s** (%s)", award.Year, award.Name, award.EventKey)
+	if !showTeams {
+		return line
+	}
+
+	var recipients []string
+	for _, r := range award.RecipientList {
+		switch {
+		case r.TeamKey != "" && r.Awardee != "":
+			recipients = append(recipients, fmt.Sprintf("%s (%s)", r.Awardee, strings.TrimPrefix(r.TeamKey, "frc")))
+		case r.TeamKey != "":
+			recipients = append(recipients, strings.TrimPrefix(r.TeamKey, "frc"))
+		case r.Awardee != "":
+			recipients = append(recipients, r.Awardee)
+		}
+	}
+	return line + " - " + strings.Join(recipients, ", ")
+}
+
+func awardsCommand(ctx *commandContext) error {
+	f := &awardFilter{awardType: -1, year: ctx.num("year"), event: ctx.str("event")}
+	if ctx.has("type") {
+		name := strings.ToLower(ctx.str("type"))
+		if t, ok := awardTypeNames[name]; ok {
+			f.awardType = t
+		} else {
+			f.name = strings.Replace(name, "-", " ", -1)
+		}
+	}
+
+	district := strings.ToLower(ctx.str("district"))
+	// The index knows each award's district, so only team and event lookups
+	// need the district's events.
+	if district != "" && (ctx.has("team") || f.event != "") {
+		year := f.year
+		if year == 0 {
+			year = time.Now().Year()
+		}
+		events, err := tbaDistrictEvents(fmt.Sprintf("%d%s", year, district))
+		if err == errTBANotFound || (err == nil && len(events) == 0) {
+			return commandError(fmt.Sprintf("TBA doesn't know about the %s district in %d.", district, year))
+		}
+		if err != nil {
+			return err
+		}
+		f.events = map[string]bool{}
+		for _, e := range events {
+			f.events[e.Key] = true
+		}
+	}
+
+	var awards []tbaAward
+	var title string
+	var err error
+	switch {
+	case ctx.has("team"):
+		team := ctx.str("team")
+		title = "Team " + team + " awards"
+		if f.year != 0 {
+			awards, err = tbaTeamYearAwards(team, f.year)
+		} else {
+			awards, err = tbaTeamAwards(team)
+		}
+
+	case f.event != "":
+		title = f.event + " awards"
+		awards, err = tbaEventAwards(f.event)
+
+	default:
+		if f.awardType < 0 && f.name == "" && district == "" {
+			return usageError("give a team, an --event, or a --type or --district to search")
+		}
+		title = "Awards"
+		if f.year != 0 {
+			title = fmt.Sprintf("%d awards", f.year)
+
+			// Stale seasons are still searched while a fresh index is
+			// built in the background.
+			var indexed bool
+			if indexed, err = awardsIndexed(f.year); err != nil {
+				return err
+			}
+			if !indexed {
+				go reindexAwards(f.year)
+			}
+		}
+
+		awards, err = searchAwards(f, district)
+		if err == nil && len(awards) == 0 && f.year != 0 {
+			return commandError(fmt.Sprintf("I don't have any matching %d awards indexed yet. If the season is still being indexed, try again in a few minutes.", f.year))
+		}
+	}
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+
+	var lines []string
+	sort.SliceStable(awards, func(i, j int) bool { return awards[i].Year > awards[j].Year })
+	for i := range awards {
+		if f.matches(&awards[i]) {
+			lines = append(lines, awardLine(&awards[i], !ctx.has("team")))
+		}
+	}
+	if len(lines) == 0 {
+		return commandError("No awards match that search.")
+	}
+
+	var filters []string
+	if ctx.has("type") {
+		filters = append(filters, "type "+ctx.str("type"))
+	}
+	if district != "" {
+		filters = append(filters, "district "+district)
+	}
+	if f.year != 0 && ctx.has("team") {
+		filters = append(filters, fmt.Sprintf("year %d", f.year))
+	}
+	footer := fmt.Sprintf("%d awards", len(lines))
+	if len(filters) > 0 {
+		footer += " • " + strings.Join(filters, ", ")
+	}
+
+	var pages []*discordgo.MessageEmbed
+	for start := 0; start < len(lines); start += awardsPerPage {
+		end := start + awardsPerPage
+		if end > len(lines) {
+			end = len(lines)
+		}
+		pages = append(pages, &discordgo.MessageEmbed{
+			Title:       title,
+			Color:       tbaColor,
+			Description: strings.Join(lines[start:end], "\n"),
+			Footer:      &discordgo.MessageEmbedFooter{Text: footer},
+		})
+	}
+
+	_, err = ctx.replyPages(pages)
+	return err
+}
+
+// reindexAwards rebuilds a season's award index in the background.
+func reindexAwards(year int) {
+	if err := indexAwards(year); err != nil {
+		log.Println(err)
+	}
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "awards",
+		aliases: []string{"a"},
+		summary: "Search awards by team, type, year, event or district.",
+		help: "`awards 2056 [year]` lists a team's awards and `awards --type impact --district ont` searches every event, " +
+			"across every season unless --year is given. " +
+			"Types include impact, ei, ras, winner, finalist, woodie, deans and gp; anything else matches the award name.",
+		args: []argSpec{
+			{name: "team", kind: argTeam, optional: true},
+			{name: "year", kind: argInt, optional: true},
+		},
+		flags: []argSpec{
+			{name: "type"},
+			{name: "year", kind: argInt},
+			{name: "event", kind: argEvent},
+			{name: "district"},
+		},
+		run: awardsCommand,
+	})
+}
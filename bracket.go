@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jlmcmchl/tbc-discord-bot/canvas"
+)
+
+// playoffDoubleElim8 is TBA's playoff type for the 8 alliance double
+// elimination bracket used since 2023.
+const playoffDoubleElim8 = 10
+
+// doubleElimSets places each of TBA's double elimination "sf" sets in the
+// bracket, along with the set its winner moves on to. A next of 0 is the
+// finals.
+var doubleElimSets = map[int]struct {
+	round int
+	lower bool
+	next  int
+}{
+	1:  {0, false, 7},
+	2:  {0, false, 7},
+	3:  {0, false, 8},
+	4:  {0, false, 8},
+	5:  {1, true, 10},
+	6:  {1, true, 9},
+	7:  {1, false, 11},
+	8:  {1, false, 11},
+	9:  {2, true, 12},
+	10: {2, true, 12},
+	11: {3, false, 0},
+	12: {3, true, 13},
+	13: {4, true, 0},
+}
+
+// legacyPlayoffTypes are TBA's best of 3 bracket playoff types: 8, 16 and 4
+// alliance brackets and finals only. Others, like 4 alliance double
+// elimination (11) and round robin (4), are refused.
+var legacyPlayoffTypes = map[int]bool{0: true, 1: true, 2: true, 7: true}
+
+// legacySets is how many best of 3 sets each legacy bracket level has, so a
+// playoff format this file doesn't know can't be drawn with made up links.
+var legacySets = map[string]int{"ef": 8, "qf": 4, "sf": 2, "f": 1}
+
+var (
+	doubleElimRounds = []string{"Round 1", "Round 2", "Round 3", "Round 4", "Round 5", "Finals"}
+	legacyLevels     = []string{"ef", "qf", "sf", "f"}
+	legacyRounds     = map[string]string{"ef": "Octofinals", "qf": "Quarterfinals", "sf": "Semifinals", "f": "Finals"}
+)
+
+// bracketSeries is one pairing in a bracket: a single match in the double
+// elimination rounds, or a best of 3 everywhere else.
+type bracketSeries struct {
+	Key       string
+	Name      string
+	Round     int
+	Lower     bool
+	Next      string
+	BestOf    int
+	Red, Blue []string
+	RedWins   int
+	BlueWins  int
+	Scores    []string
+	Winner    string
+}
+
+type bracket struct {
+	Event      *tbaEvent
+	DoubleElim bool
+	Rounds     []string
+	Series     []*bracketSeries
+	Alliances  []tbaAlliance
+}
+
+func (s *bracketSeries) decided() {
+	needed := s.BestOf/2 + 1
+	switch {
+	case s.RedWins >= needed:
+		s.Winner = "red"
+	case s.BlueWins >= needed:
+		s.Winner = "blue"
+	}
+}
+
+// loadBracket rebuilds an event's playoff bracket from its matches and
+// alliances.
+func loadBracket(event string) (*bracket, error) {
+	e, err := tbaEventInfo(event)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := tbaEventMatches(event)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	alliances, err := tbaEventAlliances(event)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	return buildBracket(e, matches, alliances)
+}
+
+// buildBracket places an event's playoff matches into series and rounds.
+func buildBracket(e *tbaEvent, matches []tbaMatch, alliances []tbaAlliance) (*bracket, error) {
+	b := &bracket{Event: e, Alliances: alliances}
+	b.DoubleElim = e.PlayoffType != nil && *e.PlayoffType == playoffDoubleElim8
+	unsupported := commandError(fmt.Sprintf("%s doesn't use a playoff format I can draw. "+
+		"Only 8 alliance double elimination and best of 3 brackets are supported.", e.Key))
+	if e.PlayoffType != nil && !b.DoubleElim && !legacyPlayoffTypes[*e.PlayoffType] {
+		return nil, unsupported
+	}
+
+	var playoffs []*tbaMatch
+	levels := map[string]bool{}
+	for i := range matches {
+		if m := &matches[i]; m.CompLevel != "qm" && m.Alliances["red"] != nil && m.Alliances["blue"] != nil {
+			playoffs = append(playoffs, m)
+			levels[m.CompLevel] = true
+		}
+	}
+	if len(playoffs) == 0 {
+		return nil, commandError(fmt.Sprintf("%s doesn't have any playoff matches yet.", e.Key))
+	}
+	sort.Slice(playoffs, func(i, j int) bool { return matchLess(playoffs[i], playoffs[j]) })
+
+	rounds := map[string]int{}
+	if b.DoubleElim {
+		b.Rounds = doubleElimRounds
+	} else {
+		for _, level := range legacyLevels {
+			if levels[level] {
+				rounds[level] = len(b.Rounds)
+				b.Rounds = append(b.Rounds, legacyRounds[level])
+			}
+		}
+	}
+
+	series := map[string]*bracketSeries{}
+	for _, m := range playoffs {
+		key := fmt.Sprintf("%s%d", m.CompLevel, m.SetNumber)
+		s, ok := series[key]
+		if !ok {
+			s = &bracketSeries{
+				Key:    key,
+				BestOf: 3,
+				Red:    m.Alliances["red"].TeamKeys,
+				Blue:   m.Alliances["blue"].TeamKeys,
+			}
+			switch {
+			case m.CompLevel == "f":
+				s.Name, s.Round = "Finals", len(b.Rounds)-1
+			case b.DoubleElim:
+				set, ok := doubleElimSets[m.SetNumber]
+				if !ok {
+					continue
+				}
+				s.Name, s.Round, s.Lower, s.BestOf = fmt.Sprintf("M%d", m.SetNumber), set.round, set.lower, 1
+				s.Next = "f1"
+				if set.next != 0 {
+					s.Next = fmt.Sprintf("sf%d", set.next)
+				}
+			default:
+				// 4 alliance double elimination and other formats reuse the
+				// legacy levels with more sets than a best of 3 bracket.
+				if m.SetNumber < 1 || m.SetNumber > legacySets[m.CompLevel] {
+					return nil, unsupported
+				}
+				s.Name, s.Round = fmt.Sprintf("%s%d", strings.ToUpper(m.CompLevel), m.SetNumber), rounds[m.CompLevel]
+				if s.Round+1 < len(b.Rounds) {
+					next := legacyLevels[compLevelOrders[m.CompLevel]]
+					s.Next = fmt.Sprintf("%s%d", next, (m.SetNumber+1)/2)
+				}
+			}
+			series[key] = s
+			b.Series = append(b.Series, s)
+		}
+
+		if !m.played() {
+			continue
+		}
+		s.Scores = append(s.Scores, fmt.Sprintf("%d-%d", m.Alliances["red"].Score, m.Alliances["blue"].Score))
+		switch m.WinningAlliance {
+		case "red":
+			s.RedWins++
+		case "blue":
+			s.BlueWins++
+		}
+		s.decided()
+	}
+	return b, nil
+}
+
+// label is the short name of the alliance a team list belongs to, like A1.
+func (b *bracket) label(teams []string) string {
+	name := allianceNumber(b.Alliances, teams)
+	if name == "" {
+		return strings.Replace(teamList(teams), ", ", "/", -1)
+	}
+	return strings.Replace(name, "Alliance ", "A", 1)
+}
+
+// champion is the label of the bracket's winner, or "" until the finals are
+// decided.
+func (b *bracket) champion() string {
+	for _, s := range b.Series {
+		if s.Key == "f1" && s.Winner != "" {
+			if s.Winner == "red" {
+				return b.label(s.Red)
+			}
+			return b.label(s.Blue)
+		}
+	}
+	return ""
+}
+
+func (s *bracketSeries) line(b *bracket) string {
+	red, blue := b.label(s.Red), b.label(s.Blue)
+	result := fmt.Sprintf("%s vs %s", red, blue)
+	switch s.Winner {
+	case "red":
+		result = fmt.Sprintf("%s def. %s", red, blue)
+	case "blue":
+		result = fmt.Sprintf("%s def. %s", blue, red)
+	}
+
+	line := fmt.Sprintf("  %-6s %-14s", s.Name, result)
+	if len(s.Scores) == 0 {
+		return strings.TrimRight(line, " ")
+	}
+	if s.BestOf == 1 {
+		return line + " " + strings.Join(s.Scores, ", ")
+	}
+	wins := fmt.Sprintf("%d-%d", s.RedWins, s.BlueWins)
+	if s.Winner == "blue" {
+		wins = fmt.Sprintf("%d-%d", s.BlueWins, s.RedWins)
+	}
+	return fmt.Sprintf("%s %s (%s)", line, wins, strings.Join(s.Scores, ", "))
+}
+
+// text draws the bracket as a plain text diagram, a round at a time.
+func (b *bracket) text() string {
+	var lines []string
+	for round, name := range b.Rounds {
+		for _, lower := range []bool{false, true} {
+			var group []string
+			for _, s := range b.Series {
+				if s.Round == round && s.Lower == lower {
+					group = append(group, s.line(b))
+				}
+			}
+			if len(group) == 0 {
+				continue
+			}
+			header := name
+			if b.DoubleElim && round < len(b.Rounds)-1 {
+				if lower {
+					header += " (lower)"
+				} else {
+					header += " (upper)"
+				}
+			}
+			lines = append(lines, header)
+			lines = append(lines, group...)
+		}
+	}
+
+	if champion := b.champion(); champion != "" {
+		lines = append(lines, "", "Winner: "+champion)
+	}
+	if len(b.Alliances) > 0 {
+		lines = append(lines, "")
+		for i := range b.Alliances {
+			lines = append(lines, fmt.Sprintf("%-4s %s", b.label(b.Alliances[i].Picks), teamList(b.Alliances[i].Picks)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// message is the bracket's text diagram formatted for Discord.
+func (b *bracket) message() string {
+	title := fmt.Sprintf("**%d %s playoffs**\n", b.Event.Year, b.Event.Name)
+	return title + "```\n" + truncate(b.text(), 1950-len(title)) + "\n```"
+}
+
+// Sizes in pixels for the bracket image.
+const (
+	bracketMargin = 24
+	bracketBoxW   = 300
+	bracketBoxH   = 44
+	bracketGap    = 48
+	bracketSlot   = 64
+	bracketTitleH = 56
+	bracketScale  = 2
+)
+
+// png draws the bracket. Series that are fed by earlier series are placed
+// between them, so the lines read left to right like a printed bracket.
+func (b *bracket) png() ([]byte, error) {
+	var upper, lower int
+	feeders := map[string][]*bracketSeries{}
+	for _, s := range b.Series {
+		feeders[s.Next] = append(feeders[s.Next], s)
+	}
+	for _, s := range b.Series {
+		if len(feeders[s.Key]) == 0 {
+			if s.Lower {
+				lower++
+			} else {
+				upper++
+			}
+		}
+	}
+	if upper == 0 {
+		upper = 1
+	}
+
+	lowerTop := bracketTitleH + upper*bracketSlot
+	if lower > 0 {
+		lowerTop += bracketSlot / 2
+	}
+	width := 2*bracketMargin + len(b.Rounds)*(bracketBoxW+bracketGap) - bracketGap
+	height := lowerTop + lower*bracketSlot + bracketMargin
+
+	var (
+		bg      = canvas.Hex(0x2f3136)
+		fg      = canvas.Hex(0xffffff)
+		dim     = canvas.Hex(0x99aab5)
+		red     = canvas.Hex(redColor)
+		blue    = canvas.Hex(blueColor)
+		redDim  = canvas.Hex(0x5c2a2c)
+		blueDim = canvas.Hex(0x23364d)
+	)
+	c := canvas.New(width, height, bg)
+	c.Text(bracketMargin, bracketMargin/2, fmt.Sprintf("%d %s", b.Event.Year, b.Event.Name), bracketScale, fg)
+	for i, name := range b.Rounds {
+		c.TextCentered(bracketMargin+i*(bracketBoxW+bracketGap)+bracketBoxW/2, bracketTitleH-20, name, bracketScale, dim)
+	}
+
+	centers := map[string]int{}
+	stacked := map[bool]int{}
+	for round := range b.Rounds {
+		for _, s := range b.Series {
+			if s.Round != round {
+				continue
+			}
+			if from := feeders[s.Key]; len(from) > 0 {
+				sum := 0
+				for _, f := range from {
+					sum += centers[f.Key]
+				}
+				centers[s.Key] = sum / len(from)
+			} else {
+				top := bracketTitleH
+				if s.Lower {
+					top = lowerTop
+				}
+				centers[s.Key] = top + stacked[s.Lower]*bracketSlot + bracketSlot/2
+				stacked[s.Lower]++
+			}
+		}
+	}
+
+	for _, s := range b.Series {
+		x := bracketMargin + s.Round*(bracketBoxW+bracketGap)
+		y := centers[s.Key]
+		if next, ok := centers[s.Next]; ok && s.Next != "" {
+			nextX := bracketMargin + (s.Round+1)*(bracketBoxW+bracketGap)
+			for _, n := range b.Series {
+				if n.Key == s.Next {
+					nextX = bracketMargin + n.Round*(bracketBoxW+bracketGap)
+				}
+			}
+			elbow := nextX - bracketGap/2
+			c.Line(x+bracketBoxW, y, elbow, y, 2, dim)
+			c.Line(elbow, y, elbow, next, 2, dim)
+			c.Line(elbow, next, nextX, next, 2, dim)
+		}
+
+		top := y - bracketBoxH/2
+		rows := []struct {
+			color      string
+			teams      []string
+			wins       int
+			full, dark color.Color
+		}{
+			{"red", s.Red, s.RedWins, red, redDim},
+			{"blue", s.Blue, s.BlueWins, blue, blueDim},
+		}
+		for i, row := range rows {
+			rowY := top + i*bracketBoxH/2
+			fill := row.full
+			if s.Winner != "" && s.Winner != row.color {
+				fill = row.dark
+			}
+			c.Rect(x, rowY, bracketBoxW, bracketBoxH/2, fill)
+
+			text := fg
+			if s.Winner != "" && s.Winner != row.color {
+				text = dim
+			}
+			textY := rowY + (bracketBoxH/2-canvas.TextHeight(bracketScale))/2
+			c.Text(x+6, textY, b.label(row.teams)+" "+strings.Replace(teamList(row.teams), ",", "", -1), bracketScale, text)
+			if len(s.Scores) > 0 {
+				score := fmt.Sprint(row.wins)
+				if s.BestOf == 1 {
+					var redScore, blueScore int
+					fmt.Sscanf(s.Scores[len(s.Scores)-1], "%d-%d", &redScore, &blueScore)
+					score = fmt.Sprint(redScore)
+					if row.color == "blue" {
+						score = fmt.Sprint(blueScore)
+					}
+				}
+				c.TextRight(x+bracketBoxW-6, textY, score, bracketScale, text)
+			}
+		}
+		c.Border(x, top, bracketBoxW, bracketBoxH, 1, dim)
+		c.Text(x, top-canvas.TextHeight(1)-3, s.Name, 1, dim)
+	}
+	return c.PNG()
+}
+
+// sendBracket posts a bracket's text diagram with its image attached.
+func sendBracket(dg *discordgo.Session, channel string, b *bracket) (*discordgo.Message, error) {
+	image, err := b.png()
+	if err != nil {
+		return nil, err
+	}
+	return dg.ChannelFileSendWithMessage(channel, b.message(), b.Event.Key+"-bracket.png", bytes.NewReader(image))
+}
+
+func bracketCommand(ctx *commandContext) error {
+	event := ctx.str("event")
+	if ctx.flag("pin") && !isAdmin(ctx.dg, ctx.msg) {
+		return commandError("Only admins can pin a bracket.")
+	}
+
+	b, err := loadBracket(event)
+	if err != nil {
+		return err
+	}
+	msg, err := sendBracket(ctx.dg, ctx.msg.ChannelID, b)
+	if err != nil || !ctx.flag("pin") {
+		return err
+	}
+
+	if err = ctx.dg.ChannelMessagePin(ctx.msg.ChannelID, msg.ID); err != nil {
+		return commandError("I couldn't pin the bracket. Do I have the Manage Messages permission here?")
+	}
+
+	var old string
+	err = db.QueryRow("SELECT Message FROM Bracket_Pins WHERE Channel = $1 AND Event = $2", ctx.msg.ChannelID, event).Scan(&old)
+	if err == nil {
+		ctx.dg.ChannelMessageDelete(ctx.msg.ChannelID, old)
+	}
+	_, err = db.Exec(`INSERT INTO Bracket_Pins (Channel, Event, Message, Summary) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (Channel, Event) DO UPDATE SET Message = EXCLUDED.Message, Summary = EXCLUDED.Summary`,
+		ctx.msg.ChannelID, event, msg.ID, b.text())
+	return err
+}
+
+// updateBracketPins reposts pinned brackets whose results have changed.
+// Discord can't replace an attachment, so the new bracket is pinned and the
+// old message deleted. Pins stop updating once the finals are decided.
+func updateBracketPins() {
+	dg := session
+	if dg == nil {
+		return
+	}
+
+	type pin struct{ channel, event, message, summary string }
+	rows, err := db.Query("SELECT Channel, Event, Message, Summary FROM Bracket_Pins")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	var pins []pin
+	for rows.Next() {
+		var p pin
+		if err = rows.Scan(&p.channel, &p.event, &p.message, &p.summary); err != nil {
+			log.Println(err)
+			break
+		}
+		pins = append(pins, p)
+	}
+	rows.Close()
+
+	brackets := map[string]*bracket{}
+	for _, p := range pins {
+		b, ok := brackets[p.event]
+		if !ok {
+			if b, err = loadBracket(p.event); err != nil {
+				log.Println(err)
+				continue
+			}
+			brackets[p.event] = b
+		}
+
+		// A pin that was already up to date when the finals ended still has
+		// to be retired.
+		summary := b.text()
+		if summary == p.summary {
+			if b.champion() != "" {
+				if _, err = db.Exec("DELETE FROM Bracket_Pins WHERE Channel = $1 AND Event = $2", p.channel, p.event); err != nil {
+					log.Println(err)
+				}
+			}
+			continue
+		}
+		msg, err := sendBracket(dg, p.channel, b)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if err = dg.ChannelMessagePin(p.channel, msg.ID); err != nil {
+			log.Println(err)
+		}
+		dg.ChannelMessageDelete(p.channel, p.message)
+
+		if b.champion() != "" {
+			_, err = db.Exec("DELETE FROM Bracket_Pins WHERE Channel = $1 AND Event = $2", p.channel, p.event)
+		} else {
+			_, err = db.Exec("UPDATE Bracket_Pins SET Message = $3, Summary = $4 WHERE Channel = $1 AND Event = $2",
+				p.channel, p.event, msg.ID, summary)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "bracket",
+		summary: "Show an event's playoff bracket.",
+		help: "Rebuilds the bracket from the playoff matches, for best of 3 and 8 alliance double elimination playoffs. " +
+			"Admins can use --pin to pin it and keep it updated as matches finish.",
+		args:  []argSpec{{name: "event", kind: argEvent}},
+		flags: []argSpec{{name: "pin", kind: argBool}},
+		run:   bracketCommand,
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import "testing"
+
+// playoffMatch builds a playoff match between two single team alliances. A
+// negative score means it hasn't been played.
+func playoffMatch(level string, set, number int, red, blue string, redScore, blueScore int) tbaMatch {
+	m := tbaMatch{
+		CompLevel:   level,
+		SetNumber:   set,
+		MatchNumber: number,
+		Alliances: map[string]*tbaMatchAlliance{
+			"red":  {Score: redScore, TeamKeys: []string{red}},
+			"blue": {Score: blueScore, TeamKeys: []string{blue}},
+		},
+	}
+	switch {
+	case redScore > blueScore:
+		m.WinningAlliance = "red"
+	case blueScore > redScore:
+		m.WinningAlliance = "blue"
+	}
+	return m
+}
+
+func seriesByKey(b *bracket) map[string]*bracketSeries {
+	series := map[string]*bracketSeries{}
+	for _, s := range b.Series {
+		series[s.Key] = s
+	}
+	return series
+}
+
+func TestBuildBracketDoubleElim(t *testing.T) {
+	playoffType := playoffDoubleElim8
+	e := &tbaEvent{Key: "2024casj", PlayoffType: &playoffType}
+	alliances := []tbaAlliance{{Name: "Alliance 1", Picks: []string{"frc1"}}, {Picks: []string{"frc2"}}}
+	matches := []tbaMatch{
+		playoffMatch("qm", 1, 1, "frc1", "frc2", 10, 5),
+		playoffMatch("f", 1, 2, "frc1", "frc2", 30, 20),
+		playoffMatch("sf", 1, 1, "frc1", "frc8", 50, 40),
+		playoffMatch("sf", 13, 1, "frc2", "frc3", 40, 45),
+		playoffMatch("sf", 7, 1, "frc1", "frc4", -1, -1),
+		// Sets past the 8 alliance bracket are left out.
+		playoffMatch("sf", 14, 1, "frc5", "frc6", 10, 5),
+		playoffMatch("f", 1, 1, "frc1", "frc2", 30, 20),
+	}
+
+	b, err := buildBracket(e, matches, alliances)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.DoubleElim || len(b.Rounds) != 6 {
+		t.Fatalf("DoubleElim, Rounds = %v, %v, want a 6 round double elimination bracket", b.DoubleElim, b.Rounds)
+	}
+
+	series := seriesByKey(b)
+	if len(series) != 4 || series["sf14"] != nil {
+		t.Errorf("series = %v, want sf1, sf7, sf13 and f1", series)
+	}
+	tests := []struct {
+		key, name string
+		round     int
+		lower     bool
+		next      string
+		bestOf    int
+		winner    string
+	}{
+		{"sf1", "M1", 0, false, "sf7", 1, "red"},
+		{"sf7", "M7", 1, false, "sf11", 1, ""},
+		{"sf13", "M13", 4, true, "f1", 1, "blue"},
+		{"f1", "Finals", 5, false, "", 3, "red"},
+	}
+	for _, test := range tests {
+		s := series[test.key]
+		if s == nil {
+			t.Errorf("%s is missing", test.key)
+			continue
+		}
+		if s.Name != test.name || s.Round != test.round || s.Lower != test.lower || s.Next != test.next || s.BestOf != test.bestOf || s.Winner != test.winner {
+			t.Errorf("%s = %+v, want %+v", test.key, *s, test)
+		}
+	}
+	if f := series["f1"]; len(f.Scores) != 2 || f.RedWins != 2 {
+		t.Errorf("f1 scores, red wins = %v, %d, want two wins", f.Scores, f.RedWins)
+	}
+	if got := b.champion(); got != "A1" {
+		t.Errorf("champion = %q, want A1", got)
+	}
+}
+
+func TestBuildBracketLegacy(t *testing.T) {
+	e := &tbaEvent{Key: "2019casj"}
+	matches := []tbaMatch{
+		playoffMatch("qf", 3, 1, "frc3", "frc6", 10, 20),
+		playoffMatch("qf", 1, 1, "frc1", "frc8", 10, 5),
+		playoffMatch("qf", 1, 2, "frc1", "frc8", 5, 10),
+		playoffMatch("sf", 2, 1, "frc2", "frc6", -1, -1),
+		playoffMatch("f", 1, 1, "frc1", "frc2", -1, -1),
+	}
+
+	b, err := buildBracket(e, matches, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Quarterfinals", "Semifinals", "Finals"}; len(b.Rounds) != len(want) || b.Rounds[0] != want[0] || b.Rounds[2] != want[2] {
+		t.Errorf("Rounds = %v, want %v", b.Rounds, want)
+	}
+
+	series := seriesByKey(b)
+	tests := []struct {
+		key, name string
+		round     int
+		next      string
+		red, blue int
+	}{
+		{"qf1", "QF1", 0, "sf1", 1, 1},
+		{"qf3", "QF3", 0, "sf2", 0, 1},
+		{"sf2", "SF2", 1, "f1", 0, 0},
+		{"f1", "Finals", 2, "", 0, 0},
+	}
+	for _, test := range tests {
+		s := series[test.key]
+		if s == nil {
+			t.Errorf("%s is missing", test.key)
+			continue
+		}
+		if s.Name != test.name || s.Round != test.round || s.Next != test.next || s.RedWins != test.red || s.BlueWins != test.blue || s.Winner != "" {
+			t.Errorf("%s = %+v, want %+v", test.key, *s, test)
+		}
+	}
+	if got := b.champion(); got != "" {
+		t.Errorf("champion = %q before the finals", got)
+	}
+}
+
+func TestBuildBracketUnsupported(t *testing.T) {
+	roundRobin := 4
+	tests := []struct {
+		name    string
+		e       *tbaEvent
+		matches []tbaMatch
+	}{
+		{"round robin", &tbaEvent{Key: "2019cmptx", PlayoffType: &roundRobin}, []tbaMatch{playoffMatch("sf", 1, 1, "frc1", "frc2", 1, 0)}},
+		{"extra sets", &tbaEvent{Key: "2019casj"}, []tbaMatch{playoffMatch("qf", 5, 1, "frc1", "frc2", 1, 0)}},
+		{"no playoffs", &tbaEvent{Key: "2019casj"}, []tbaMatch{playoffMatch("qm", 1, 1, "frc1", "frc2", 1, 0)}},
+	}
+	for _, test := range tests {
+		if _, err := buildBracket(test.e, test.matches, nil); err == nil {
+			t.Errorf("%s: buildBracket didn't fail", test.name)
+		} else if _, ok := err.(commandError); !ok {
+			t.Errorf("%s: error = %#v, want a commandError", test.name, err)
+		}
+	}
+}
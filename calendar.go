@@ -0,0 +1,382 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	eventsPerPage = 15
+
+	// feedCacheTTL is how long a built events feed is served before TBA is
+	// asked again.
+	feedCacheTTL = 15 * time.Minute
+	// feedCacheMax bounds the cache, since anyone can pick feed parameters.
+	feedCacheMax = 256
+)
+
+var weekRegex = regexp.MustCompile(`^week\s+(\d+)$`)
+
+type cachedFeed struct {
+	data    []byte
+	expires time.Time
+}
+
+var (
+	feedCache      = map[string]cachedFeed{}
+	feedCacheMutex = &sync.Mutex{}
+)
+
+func cachedFeedData(key string) ([]byte, bool) {
+	feedCacheMutex.Lock()
+	defer feedCacheMutex.Unlock()
+	f, ok := feedCache[key]
+	if !ok || time.Now().After(f.expires) {
+		return nil, false
+	}
+	return f.data, true
+}
+
+func storeFeed(key string, data []byte) {
+	feedCacheMutex.Lock()
+	defer feedCacheMutex.Unlock()
+	now := time.Now()
+	for k, f := range feedCache {
+		if now.After(f.expires) {
+			delete(feedCache, k)
+		}
+	}
+	if len(feedCache) >= feedCacheMax {
+		feedCache = map[string]cachedFeed{}
+	}
+	feedCache[key] = cachedFeed{data: data, expires: now.Add(feedCacheTTL)}
+}
+
+// feedToken returns the secret that unlocks a guild's calendar feeds, making
+// one the first time it is asked for.
+func feedToken(guild string) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	_, err := db.Exec("INSERT INTO Feed_Tokens (Guild, Token) VALUES ($1, $2) ON CONFLICT (Guild) DO NOTHING",
+		guild, hex.EncodeToString(raw))
+	if err != nil {
+		return "", err
+	}
+
+	var token string
+	err = db.QueryRow("SELECT Token FROM Feed_Tokens WHERE Guild = $1", guild).Scan(&token)
+	return token, err
+}
+
+// feedGuild returns the guild a feed token belongs to, or "" for an unknown
+// token.
+func feedGuild(token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	var guild string
+	err := db.QueryRow("SELECT Guild FROM Feed_Tokens WHERE Token = $1", token).Scan(&guild)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return guild, err
+}
+
+// feedError logs why a feed couldn't be built and gives the client a generic
+// message.
+func feedError(c *gin.Context, status int, err error) {
+	log.Println(err)
+	c.String(status, "couldn't build the calendar feed")
+}
+
+// eventFilter picks events out of a season for !events.
+type eventFilter struct {
+	desc  string
+	match func(e *tbaEvent) bool
+}
+
+// weekOf returns the Monday starting the week containing t.
+func weekOf(t time.Time) time.Time {
+	day := t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// overlaps reports whether an event runs at any point in [from, to).
+func overlaps(e *tbaEvent, from, to time.Time) bool {
+	start, end := e.dates()
+	return start.Before(to) && !end.Before(from)
+}
+
+// parseEventFilter understands "this week", "next week", "week N", a
+// district abbreviation, or a state, province or country.
+func parseEventFilter(raw string, events []tbaEvent) (*eventFilter, error) {
+	raw = strings.ToLower(strings.Join(strings.Fields(raw), " "))
+	monday := weekOf(time.Now().UTC())
+
+	switch raw {
+	case "", "this week":
+		return &eventFilter{"this week", func(e *tbaEvent) bool { return overlaps(e, monday, monday.AddDate(0, 0, 7)) }}, nil
+	case "next week":
+		next := monday.AddDate(0, 0, 7)
+		return &eventFilter{"next week", func(e *tbaEvent) bool { return overlaps(e, next, next.AddDate(0, 0, 7)) }}, nil
+	}
+
+	if match := weekRegex.FindStringSubmatch(raw); match != nil {
+		week, _ := strconv.Atoi(match[1])
+		// TBA numbers weeks from 0.
+		return &eventFilter{"week " + match[1], func(e *tbaEvent) bool { return e.Week != nil && *e.Week == week-1 }}, nil
+	}
+
+	for i := range events {
+		if d := events[i].District; d != nil && strings.ToLower(d.Abbreviation) == raw {
+			return &eventFilter{d.DisplayName + " district", func(e *tbaEvent) bool {
+				return e.District != nil && strings.ToLower(e.District.Abbreviation) == raw
+			}}, nil
+		}
+	}
+
+	for i := range events {
+		if strings.EqualFold(events[i].StateProv, raw) || strings.EqualFold(events[i].Country, raw) {
+			return &eventFilter{raw, func(e *tbaEvent) bool {
+				return strings.EqualFold(e.StateProv, raw) || strings.EqualFold(e.Country, raw)
+			}}, nil
+		}
+	}
+
+	return nil, commandError(fmt.Sprintf("%q isn't a week, district, state or country with events this season.", raw))
+}
+
+func sortEvents(events []tbaEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].StartDate != events[j].StartDate {
+			return events[i].StartDate < events[j].StartDate
+		}
+		return events[i].Name < events[j].Name
+	})
+}
+
+func eventsCommand(ctx *commandContext) error {
+	year := time.Now().Year()
+	if ctx.has("year") {
+		year = ctx.num("year")
+	}
+
+	events, err := tbaEvents(year)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+
+	filter, err := parseEventFilter(ctx.str("filter"), events)
+	if err != nil {
+		return err
+	}
+
+	var matched []tbaEvent
+	for i := range events {
+		if filter.match(&events[i]) && (events[i].official() || ctx.flag("all")) {
+			matched = append(matched, events[i])
+		}
+	}
+	if len(matched) == 0 {
+		return commandError(fmt.Sprintf("No %d events %s.", year, filter.desc))
+	}
+	sortEvents(matched)
+
+	var lines []string
+	for i := range matched {
+		e := &matched[i]
+		lines = append(lines, fmt.Sprintf("**%s** (%s)\n%s • %s", e.Name, e.Key, eventDates(e), orNone(e.location())))
+	}
+
+	footer := fmt.Sprintf("%d events", len(matched))
+	if publicURL != "" {
+		footer += " • calendar feed: " + publicURL + "/events.ics"
+		if ctx.guild != "" {
+			token, err := feedToken(ctx.guild)
+			if err != nil {
+				return err
+			}
+			footer += " • this server's followed events: " + publicURL + "/events.ics?token=" + token
+		}
+	}
+
+	var pages []*discordgo.MessageEmbed
+	for start := 0; start < len(lines); start += eventsPerPage {
+		end := start + eventsPerPage
+		if end > len(lines) {
+			end = len(lines)
+		}
+		pages = append(pages, &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("%d events %s", year, filter.desc),
+			URL:         fmt.Sprintf("https://www.thebluealliance.com/events/%d", year),
+			Color:       tbaColor,
+			Description: strings.Join(lines[start:end], "\n"),
+			Footer:      &discordgo.MessageEmbedFooter{Text: footer},
+		})
+	}
+
+	_, err = ctx.replyPages(pages)
+	return err
+}
+
+func eventICS(e *tbaEvent) icsEvent {
+	start, end := e.dates()
+	return icsEvent{
+		UID:         e.Key + "@tbc-discord-bot",
+		Summary:     e.Name,
+		Description: e.EventTypeString,
+		Location:    e.location(),
+		URL:         "https://www.thebluealliance.com/event/" + e.Key,
+		Start:       start,
+		End:         end,
+		AllDay:      true,
+	}
+}
+
+// eventsFeed serves an iCalendar feed of a season's events. The district,
+// team and token query parameters each add events: a district's events, a
+// team's events, or every event followed in the channels of the guild the
+// secret token belongs to. With none of them it has every official event.
+// Feeds are cached for feedCacheTTL so they can't be used to drain the TBA
+// quota.
+func eventsFeed(c *gin.Context) {
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(time.Now().Year())))
+	if err != nil {
+		c.String(http.StatusBadRequest, string("year must be a year"))
+		return
+	}
+	district, team, token := strings.ToLower(c.Query("district")), c.Query("team"), c.Query("token")
+
+	guild, err := feedGuild(token)
+	if err != nil {
+		feedError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if token != "" && guild == "" {
+		c.String(http.StatusNotFound, "unknown feed token")
+		return
+	}
+
+	cacheKey := fmt.Sprintf("%d|%s|%s|%s", year, district, team, guild)
+	if data, ok := cachedFeedData(cacheKey); ok {
+		c.Header("Content-Disposition", "inline; filename="+url.PathEscape(fmt.Sprintf("frc-%d.ics", year)))
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", data)
+		return
+	}
+
+	keys := map[string]bool{}
+	var events []tbaEvent
+	add := func(found []tbaEvent) {
+		for _, e := range found {
+			if !keys[e.Key] {
+				keys[e.Key] = true
+				events = append(events, e)
+			}
+		}
+	}
+
+	if district != "" {
+		found, err := tbaDistrictEvents(fmt.Sprintf("%d%s", year, district))
+		if err = ignoreNotFound(err); err != nil {
+			feedError(c, http.StatusBadGateway, err)
+			return
+		}
+		add(found)
+	}
+	if team != "" {
+		found, err := tbaTeamEvents(strings.TrimPrefix(team, "frc"), year)
+		if err = ignoreNotFound(err); err != nil {
+			feedError(c, http.StatusBadGateway, err)
+			return
+		}
+		add(found)
+	}
+	if guild != "" {
+		rows, err := db.Query("SELECT DISTINCT Target FROM Follows WHERE Guild = $1 AND Kind = $2 AND Target LIKE $3",
+			guild, followEvent, strconv.Itoa(year)+"%")
+		if err != nil {
+			feedError(c, http.StatusInternalServerError, err)
+			return
+		}
+		var followed []string
+		for rows.Next() {
+			var key string
+			if err = rows.Scan(&key); err == nil {
+				followed = append(followed, key)
+			}
+		}
+		rows.Close()
+
+		for _, key := range followed {
+			e, err := tbaEventInfo(key)
+			if err == nil {
+				add([]tbaEvent{*e})
+			}
+		}
+	}
+	if district == "" && team == "" && guild == "" {
+		all, err := tbaEvents(year)
+		if err = ignoreNotFound(err); err != nil {
+			feedError(c, http.StatusBadGateway, err)
+			return
+		}
+		for _, e := range all {
+			if e.official() {
+				add([]tbaEvent{e})
+			}
+		}
+	}
+	sortEvents(events)
+
+	var filters []string
+	if district != "" {
+		filters = append(filters, "district "+district)
+	}
+	if team != "" {
+		filters = append(filters, "team "+team)
+	}
+	if guild != "" {
+		filters = append(filters, "followed")
+	}
+	name := fmt.Sprintf("FRC %d events", year)
+	if len(filters) > 0 {
+		name += " (" + strings.Join(filters, ", ") + ")"
+	}
+
+	feed := make([]icsEvent, len(events))
+	for i := range events {
+		feed[i] = eventICS(&events[i])
+	}
+	data := writeICS(name, feed)
+	storeFeed(cacheKey, data)
+	c.Header("Content-Disposition", "inline; filename="+url.PathEscape(fmt.Sprintf("frc-%d.ics", year)))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", data)
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "events",
+		summary: "List a season's events by week, district or location.",
+		help: "`events` shows this week, and `events next week`, `events week 3`, `events fim` or `events CA` filter by week, " +
+			"district or state. Use --all to include offseason events.",
+		args:  []argSpec{{name: "filter", kind: argText, optional: true}},
+		flags: []argSpec{{name: "year", kind: argInt}, {name: "all", kind: argBool}},
+		run:   eventsCommand,
+	})
+}
@@ -0,0 +1,134 @@
+// Package canvas draws simple images such as brackets and charts using only
+// the standard library, with a built in bitmap font for labels.
+package canvas
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+)
+
+// Canvas is an image that shapes and text can be drawn on.
+type Canvas struct {
+	img *image.RGBA
+}
+
+// New returns a w by h canvas filled with bg.
+func New(w, h int, bg color.Color) *Canvas {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{bg}, image.Point{}, draw.Src)
+	return &Canvas{img: img}
+}
+
+// Hex turns a color like 0x3f51b5 into a color.Color.
+func Hex(rgb int) color.Color {
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}
+}
+
+// Width and Height are the canvas's dimensions.
+func (c *Canvas) Width() int  { return c.img.Bounds().Dx() }
+func (c *Canvas) Height() int { return c.img.Bounds().Dy() }
+
+// Rect fills a rectangle.
+func (c *Canvas) Rect(x, y, w, h int, col color.Color) {
+	draw.Draw(c.img, image.Rect(x, y, x+w, y+h).Intersect(c.img.Bounds()), &image.Uniform{col}, image.Point{}, draw.Src)
+}
+
+// Border outlines a rectangle with a line of the given thickness.
+func (c *Canvas) Border(x, y, w, h, thickness int, col color.Color) {
+	c.Rect(x, y, w, thickness, col)
+	c.Rect(x, y+h-thickness, w, thickness, col)
+	c.Rect(x, y, thickness, h, col)
+	c.Rect(x+w-thickness, y, thickness, h, col)
+}
+
+// Line draws a line between two points, thickness pixels wide.
+func (c *Canvas) Line(x0, y0, x1, y1, thickness int, col color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := sign(x1-x0), sign(y1-y0)
+	err := dx + dy
+	for {
+		c.Rect(x0-thickness/2, y0-thickness/2, thickness, thickness, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// TextWidth is how many pixels wide s is when drawn at scale.
+func TextWidth(s string, scale int) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (n*(glyphWidth+glyphSpacing) - glyphSpacing) * scale
+}
+
+// TextHeight is how many pixels tall a line of text is at scale.
+func TextHeight(scale int) int {
+	return glyphHeight * scale
+}
+
+// Text draws s with its top left corner at x, y. Each font pixel becomes a
+// scale by scale square.
+func (c *Canvas) Text(x, y int, s string, scale int, col color.Color) {
+	for _, r := range s {
+		rows := strings.Split(glyph(r), " ")
+		for row, bits := range rows {
+			for column, bit := range bits {
+				if bit == '1' {
+					c.Rect(x+column*scale, y+row*scale, scale, scale, col)
+				}
+			}
+		}
+		x += (glyphWidth + glyphSpacing) * scale
+	}
+}
+
+// TextCentered draws s centered horizontally on x.
+func (c *Canvas) TextCentered(x, y int, s string, scale int, col color.Color) {
+	c.Text(x-TextWidth(s, scale)/2, y, s, scale, col)
+}
+
+// TextRight draws s so that it ends at x.
+func (c *Canvas) TextRight(x, y int, s string, scale int, col color.Color) {
+	c.Text(x-TextWidth(s, scale), y, s, scale, col)
+}
+
+// PNG encodes the canvas.
+func (c *Canvas) PNG() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jlmcmchl/tbc-discord-bot/chart"
+	"github.com/jlmcmchl/tbc-discord-bot/stats"
+)
+
+const (
+	// chartTeams is how many teams get a line on rank charts.
+	chartTeams = 8
+	// chartBars is how many teams are shown on bar charts.
+	chartBars = 30
+)
+
+// replyChart uploads a rendered chart as an attachment.
+func (ctx *commandContext) replyChart(name string, image []byte) (*discordgo.Message, error) {
+	return ctx.dg.ChannelFileSend(ctx.msg.ChannelID, name, bytes.NewReader(image))
+}
+
+// rankTeams orders teams the way qualification rankings do, by average
+// ranking points and then average score.
+func rankTeams(standings map[string]stats.Standing) []string {
+	avg := func(total float64, played int) float64 {
+		if played == 0 {
+			return 0
+		}
+		return total / float64(played)
+	}
+
+	var teams []string
+	for team := range standings {
+		teams = append(teams, team)
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		a, b := standings[teams[i]], standings[teams[j]]
+		if ra, rb := avg(a.RP, a.Played), avg(b.RP, b.Played); ra != rb {
+			return ra > rb
+		}
+		if pa, pb := avg(a.Points, a.Played), avg(b.Points, b.Played); pa != pb {
+			return pa > pb
+		}
+		return teams[i] < teams[j]
+	})
+	return teams
+}
+
+// rankChart plots the estimated rank of the current top teams after every
+// played qualification match. TBA only publishes the current rankings, so
+// past ranks are rebuilt with rankTeams, which skips the game's real
+// tiebreakers and can disagree with the official order.
+func rankChart(e *tbaEvent, matches []tbaMatch) ([]byte, error) {
+	rule, err := rpRuleFor(e.Year)
+	if err != nil {
+		return nil, err
+	}
+
+	var quals []tbaMatch
+	for _, m := range matches {
+		if m.CompLevel == "qm" && m.played() {
+			quals = append(quals, m)
+		}
+	}
+	sort.Slice(quals, func(i, j int) bool { return matchLess(&quals[i], &quals[j]) })
+	rule.logMissing(e.Key, quals)
+
+	history := map[string][]chart.Point{}
+	var order []string
+	for i := range quals {
+		order = rankTeams(currentStandings(quals[:i+1], rule))
+		for rank, team := range order {
+			history[team] = append(history[team], chart.Point{X: float64(quals[i].MatchNumber), Y: float64(rank + 1)})
+		}
+	}
+	if len(order) > chartTeams {
+		order = order[:chartTeams]
+	}
+
+	line := &chart.Line{
+		Title:   fmt.Sprintf("%d %s estimated rank", e.Year, e.Name),
+		XLabel:  "Qualification match",
+		YLabel:  "Estimated rank (average RP, then average score)",
+		InvertY: true,
+	}
+	for _, team := range order {
+		line.Series = append(line.Series, chart.Series{Name: strings.TrimPrefix(team, "frc"), Points: history[team]})
+	}
+	return line.PNG()
+}
+
+// scoreChart is a histogram of every played alliance score at an event.
+func scoreChart(e *tbaEvent, matches []tbaMatch) ([]byte, error) {
+	var scores []float64
+	for i := range matches {
+		if matches[i].played() {
+			scores = append(scores, float64(matches[i].Alliances["red"].Score), float64(matches[i].Alliances["blue"].Score))
+		}
+	}
+	return (&chart.Histogram{
+		Title:  fmt.Sprintf("%d %s alliance scores", e.Year, e.Name),
+		XLabel: "Score",
+		Values: scores,
+	}).PNG()
+}
+
+// barChart plots the first chartBars teams of an already sorted list.
+func barChart(title string, teams []string, values map[string]float64) ([]byte, error) {
+	if len(teams) > chartBars {
+		teams = teams[:chartBars]
+	}
+	bar := &chart.Bar{Title: title}
+	for _, team := range teams {
+		bar.Labels = append(bar.Labels, strings.TrimPrefix(team, "frc"))
+		bar.Values = append(bar.Values, values[team])
+	}
+	return bar.PNG()
+}
+
+// eloChart plots a team's rating over a season.
+func eloChart(team string, year int, history []float64) ([]byte, error) {
+	points := make([]chart.Point, len(history))
+	for i, rating := range history {
+		points[i] = chart.Point{X: float64(i + 1), Y: rating}
+	}
+	return (&chart.Line{
+		Title:  fmt.Sprintf("Team %s Elo in %d", team, year),
+		XLabel: "Match",
+		YLabel: "Elo",
+		Series: []chart.Series{{Name: team, Points: points}},
+	}).PNG()
+}
+
+// eventCharts sends an event's summary followed by its rank and score charts
+// in place of the ranking pages.
+func eventCharts(ctx *commandContext, e *tbaEvent, summary *discordgo.MessageEmbed, matches []tbaMatch) error {
+	if _, err := ctx.replyEmbed(summary); err != nil {
+		return err
+	}
+
+	charts := []struct {
+		name   string
+		render func(*tbaEvent, []tbaMatch) ([]byte, error)
+	}{
+		{"rank", rankChart},
+		{"scores", scoreChart},
+	}
+	sent := 0
+	for _, c := range charts {
+		image, err := c.render(e, matches)
+		if err == chart.ErrNoData {
+			continue
+		}
+		// Tell the user why a chart is missing and still send the rest.
+		if msg, ok := err.(commandError); ok {
+			if _, err = ctx.reply(string(msg)); err != nil {
+				return err
+			}
+			sent++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = ctx.replyChart(fmt.Sprintf("%s-%s.png", e.Key, c.name), image); err != nil {
+			return err
+		}
+		sent++
+	}
+	if sent == 0 {
+		return commandError(fmt.Sprintf("%s doesn't have any played matches to chart yet.", e.Key))
+	}
+	return nil
+}
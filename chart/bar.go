@@ -0,0 +1,79 @@
+package chart
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+
+	"github.com/jlmcmchl/tbc-discord-bot/canvas"
+)
+
+const barRowH = 24
+
+// Bar draws a horizontal bar for each label, in the order given.
+type Bar struct {
+	Title  string
+	Labels []string
+	Values []float64
+	Color  color.Color
+}
+
+// PNG renders the chart. The image grows taller with the number of bars. A
+// value that isn't finite gets its label but no bar.
+func (b *Bar) PNG() ([]byte, error) {
+	if len(b.Values) == 0 {
+		return nil, ErrNoData
+	}
+
+	min, max := 0.0, 0.0
+	labelW := 0
+	for i, v := range b.Values {
+		if finite(v) {
+			min, max = math.Min(min, v), math.Max(max, v)
+		}
+		if w := canvas.TextWidth(b.Labels[i], scale); w > labelW {
+			labelW = w
+		}
+	}
+	xTicks, xStep := ticks(min, max, 8)
+
+	height := titleH + len(b.Values)*barRowH + axisH + margin
+	c := start(Width, height, b.Title, "", "")
+	f := &frame{
+		c:    c,
+		left: margin + labelW + 12,
+		top:  titleH,
+		h:    len(b.Values) * barRowH,
+		xMin: xTicks[0],
+		xMax: xTicks[len(xTicks)-1],
+		yMin: 0,
+		yMax: 1,
+	}
+	// Leave room past the longest bar for its value.
+	f.w = Width - f.left - margin - canvas.TextWidth("00000.0", scale)
+	f.axes(xTicks, xStep, nil, 1)
+
+	col := b.Color
+	if col == nil {
+		col = Palette[0]
+	}
+	textH := canvas.TextHeight(scale)
+	zero := f.x(0)
+	for i, v := range b.Values {
+		y := f.top + i*barRowH
+		c.TextRight(f.left-12, y+(barRowH-textH)/2, b.Labels[i], scale, foreground)
+		if !finite(v) {
+			c.Text(zero+6, y+(barRowH-textH)/2, "n/a", scale, muted)
+			continue
+		}
+
+		end := f.x(v)
+		from, to := zero, end
+		if to < from {
+			from, to = to, from
+		}
+		c.Rect(from, y+3, to-from+1, barRowH-6, col)
+		c.Text(to+6, y+(barRowH-textH)/2, strconv.FormatFloat(v, 'f', 1, 64), scale, muted)
+	}
+	return c.PNG()
+}
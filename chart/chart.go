@@ -0,0 +1,158 @@
+// Package chart renders line, bar and histogram charts as PNG images.
+package chart
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+
+	"github.com/jlmcmchl/tbc-discord-bot/canvas"
+)
+
+// Sizes in pixels shared by every chart.
+const (
+	Width  = 960
+	Height = 540
+
+	scale   = 2
+	margin  = 20
+	titleH  = 48
+	axisW   = 80
+	axisH   = 56
+	tickLen = 6
+	legendW = 150
+)
+
+var (
+	background = canvas.Hex(0x2f3136)
+	foreground = canvas.Hex(0xffffff)
+	muted      = canvas.Hex(0x99aab5)
+	grid       = canvas.Hex(0x40444b)
+
+	// Palette colors series that don't pick their own.
+	Palette = []color.Color{
+		canvas.Hex(0x3f51b5), canvas.Hex(0xed1c24), canvas.Hex(0x43b581), canvas.Hex(0xfaa61a),
+		canvas.Hex(0x9b59b6), canvas.Hex(0x1abc9c), canvas.Hex(0xe91e63), canvas.Hex(0xf1c40f),
+		canvas.Hex(0x0066b3), canvas.Hex(0xe67e22),
+	}
+)
+
+// Point is one value of a series.
+type Point struct {
+	X, Y float64
+}
+
+// Series is a named, colored set of points.
+type Series struct {
+	Name   string
+	Color  color.Color
+	Points []Point
+}
+
+func seriesColor(s Series, i int) color.Color {
+	if s.Color != nil {
+		return s.Color
+	}
+	return Palette[i%len(Palette)]
+}
+
+// finite reports whether v can be plotted.
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// ticks picks about n round numbers covering [min, max], returning them and
+// the step between them. It always returns at least two ticks, falling back
+// to [0, 1] when the range isn't finite.
+func ticks(min, max float64, n int) ([]float64, float64) {
+	if !finite(min) || !finite(max) || !finite(max-min) {
+		min, max = 0, 1
+	}
+	if max <= min {
+		max = min + 1
+	}
+	if n < 1 {
+		n = 1
+	}
+	raw := (max - min) / float64(n)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*magnitude >= raw {
+			step = m * magnitude
+			break
+		}
+	}
+
+	var result []float64
+	first, last := math.Floor(min/step), math.Ceil(max/step)
+	for i := first; i <= last; i++ {
+		result = append(result, i*step)
+	}
+	if len(result) == 1 {
+		result = append(result, result[0]+step)
+	}
+	return result, step
+}
+
+// label formats a tick value with only as many decimals as its step needs.
+func label(v, step float64) string {
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+	}
+	if math.Abs(v) < step/1e6 {
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+// frame is a plot area and the ranges its edges represent.
+type frame struct {
+	c                      *canvas.Canvas
+	left, top, w, h        int
+	xMin, xMax, yMin, yMax float64
+	invertY                bool
+}
+
+func (f *frame) x(v float64) int {
+	return f.left + int(math.Round((v-f.xMin)/(f.xMax-f.xMin)*float64(f.w)))
+}
+
+func (f *frame) y(v float64) int {
+	offset := int(math.Round((v - f.yMin) / (f.yMax - f.yMin) * float64(f.h)))
+	if f.invertY {
+		return f.top + offset
+	}
+	return f.top + f.h - offset
+}
+
+// axes draws grid lines and tick labels for both axes.
+func (f *frame) axes(xTicks []float64, xStep float64, yTicks []float64, yStep float64) {
+	textH := canvas.TextHeight(scale)
+	for _, v := range yTicks {
+		y := f.y(v)
+		f.c.Line(f.left, y, f.left+f.w, y, 1, grid)
+		f.c.TextRight(f.left-tickLen-4, y-textH/2, label(v, yStep), scale, muted)
+	}
+	for _, v := range xTicks {
+		x := f.x(v)
+		f.c.Line(x, f.top+f.h, x, f.top+f.h+tickLen, 1, muted)
+		f.c.TextCentered(x, f.top+f.h+tickLen+4, label(v, xStep), scale, muted)
+	}
+	f.c.Line(f.left, f.top, f.left, f.top+f.h, 1, muted)
+	f.c.Line(f.left, f.top+f.h, f.left+f.w, f.top+f.h, 1, muted)
+}
+
+// start draws the background, title and axis titles common to every chart.
+func start(width, height int, title, xLabel, yLabel string) *canvas.Canvas {
+	c := canvas.New(width, height, background)
+	c.Text(margin, margin, title, scale, foreground)
+	if yLabel != "" {
+		c.Text(margin, titleH, yLabel, scale, muted)
+	}
+	if xLabel != "" {
+		c.TextCentered(width/2, height-margin-canvas.TextHeight(scale), xLabel, scale, muted)
+	}
+	return c
+}
@@ -0,0 +1,87 @@
+package chart
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTicks(t *testing.T) {
+	tests := []struct {
+		min, max float64
+		n        int
+		want     []float64
+		step     float64
+	}{
+		{0, 10, 5, []float64{0, 2, 4, 6, 8, 10}, 2},
+		{3, 97, 10, []float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, 10},
+		{-0.3, 0.3, 6, []float64{-0.3, -0.2, -0.1, 0, 0.1, 0.2, 0.3}, 0.1},
+		// An empty range is widened to one unit.
+		{5, 5, 4, []float64{5, 5.5, 6}, 0.5},
+		{math.NaN(), 10, 2, []float64{0, 0.5, 1}, 0.5},
+		{0, math.Inf(1), 2, []float64{0, 0.5, 1}, 0.5},
+		{-math.MaxFloat64, math.MaxFloat64, 2, []float64{0, 0.5, 1}, 0.5},
+		{0, 10, 0, []float64{0, 10}, 10},
+	}
+	for _, test := range tests {
+		got, step := ticks(test.min, test.max, test.n)
+		if !equal(got, test.want) || !near(step, test.step) {
+			t.Errorf("ticks(%g, %g, %d) = %v, %g, want %v, %g", test.min, test.max, test.n, got, step, test.want, test.step)
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		v, step float64
+		want    string
+	}{
+		{20, 10, "20"},
+		{0.30000000000000004, 0.1, "0.3"},
+		{-1.5, 0.5, "-1.5"},
+		{0.05, 0.05, "0.05"},
+		// Rounding error around zero shouldn't print as -0.
+		{-1e-17, 0.1, "0.0"},
+		{1234567, 500000, "1234567"},
+	}
+	for _, test := range tests {
+		if got := label(test.v, test.step); got != test.want {
+			t.Errorf("label(%g, %g) = %q, want %q", test.v, test.step, got, test.want)
+		}
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	line := &Line{Series: []Series{{Points: []Point{{1, 2}, {2, nan}, {inf, 3}, {3, 4}}}}}
+	if _, err := line.PNG(); err != nil {
+		t.Errorf("Line.PNG() error = %v", err)
+	}
+	if _, err := (&Line{Series: []Series{{Points: []Point{{nan, nan}}}}}).PNG(); err != ErrNoData {
+		t.Errorf("Line.PNG() with only NaN error = %v, want ErrNoData", err)
+	}
+	if _, err := (&Histogram{Values: []float64{1, nan, 2, inf}}).PNG(); err != nil {
+		t.Errorf("Histogram.PNG() error = %v", err)
+	}
+	if _, err := (&Histogram{Values: []float64{nan}}).PNG(); err != ErrNoData {
+		t.Errorf("Histogram.PNG() with only NaN error = %v, want ErrNoData", err)
+	}
+	if _, err := (&Bar{Labels: []string{"a", "b"}, Values: []float64{nan, inf}}).PNG(); err != nil {
+		t.Errorf("Bar.PNG() error = %v", err)
+	}
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !near(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,98 @@
+package chart
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/jlmcmchl/tbc-discord-bot/canvas"
+)
+
+// Histogram counts values into evenly sized bins.
+type Histogram struct {
+	Title, XLabel string
+	Values        []float64
+	// Bins is roughly how many bins to use; the width is rounded to a nice
+	// number.
+	Bins  int
+	Color color.Color
+}
+
+// PNG renders the chart. Values that aren't finite are left out.
+func (h *Histogram) PNG() ([]byte, error) {
+	var values []float64
+	for _, v := range h.Values {
+		if finite(v) {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return nil, ErrNoData
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+	bins := h.Bins
+	if bins < 1 {
+		bins = 20
+	}
+	edges, width := ticks(min, max, bins)
+	if edges[len(edges)-1] <= max {
+		edges = append(edges, edges[len(edges)-1]+width)
+	}
+
+	counts := make([]int, len(edges)-1)
+	most := 0
+	for _, v := range values {
+		i := int((v - edges[0]) / width)
+		if i >= len(counts) {
+			i = len(counts) - 1
+		}
+		counts[i]++
+		if counts[i] > most {
+			most = counts[i]
+		}
+	}
+	yTicks, yStep := ticks(0, float64(most), 6)
+	if yStep < 1 {
+		yTicks, yStep = ticks(0, float64(most), most)
+	}
+
+	c := start(Width, Height, h.Title, h.XLabel, "Count")
+	f := &frame{
+		c:    c,
+		left: margin + axisW,
+		top:  titleH + 2*canvas.TextHeight(scale),
+		xMin: edges[0],
+		xMax: edges[len(edges)-1],
+		yMin: 0,
+		yMax: yTicks[len(yTicks)-1],
+	}
+	f.w = Width - f.left - 2*margin
+	f.h = Height - f.top - axisH - margin
+
+	// Only label every few edges so the labels don't run together.
+	xTicks := edges
+	if every := (len(edges) + 9) / 10; every > 1 {
+		xTicks = nil
+		for i := 0; i < len(edges); i += every {
+			xTicks = append(xTicks, edges[i])
+		}
+	}
+	f.axes(xTicks, width, yTicks, yStep)
+
+	col := h.Color
+	if col == nil {
+		col = Palette[0]
+	}
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		x0, x1 := f.x(edges[i]), f.x(edges[i+1])
+		y := f.y(float64(n))
+		c.Rect(x0+1, y, x1-x0-1, f.top+f.h-y, col)
+	}
+	return c.PNG()
+}
@@ -0,0 +1,89 @@
+package chart
+
+import (
+	"errors"
+	"math"
+
+	"github.com/jlmcmchl/tbc-discord-bot/canvas"
+)
+
+// ErrNoData is returned when there is nothing to plot.
+var ErrNoData = errors.New("chart: no data")
+
+// Line plots one or more series as connected points.
+type Line struct {
+	Title, XLabel, YLabel string
+	Series                []Series
+	// InvertY puts the smallest values at the top, for ranks.
+	InvertY bool
+}
+
+// PNG renders the chart.
+func (l *Line) PNG() ([]byte, error) {
+	xMin, xMax := math.Inf(1), math.Inf(-1)
+	yMin, yMax := math.Inf(1), math.Inf(-1)
+	for _, s := range l.Series {
+		for _, p := range s.Points {
+			if !finite(p.X) || !finite(p.Y) {
+				continue
+			}
+			xMin, xMax = math.Min(xMin, p.X), math.Max(xMax, p.X)
+			yMin, yMax = math.Min(yMin, p.Y), math.Max(yMax, p.Y)
+		}
+	}
+	if math.IsInf(xMin, 0) {
+		return nil, ErrNoData
+	}
+
+	legend := len(l.Series) > 1
+	right := margin
+	if legend {
+		right += legendW
+	}
+
+	xTicks, xStep := ticks(xMin, xMax, 10)
+	yTicks, yStep := ticks(yMin, yMax, 6)
+	c := start(Width, Height, l.Title, l.XLabel, l.YLabel)
+	f := &frame{
+		c:       c,
+		left:    margin + axisW,
+		top:     titleH + 2*canvas.TextHeight(scale),
+		xMin:    xTicks[0],
+		xMax:    xTicks[len(xTicks)-1],
+		yMin:    yTicks[0],
+		yMax:    yTicks[len(yTicks)-1],
+		invertY: l.InvertY,
+	}
+	f.w = Width - f.left - right
+	f.h = Height - f.top - axisH - margin
+	f.axes(xTicks, xStep, yTicks, yStep)
+
+	for i, s := range l.Series {
+		col := seriesColor(s, i)
+		drawn := false
+		var prevX, prevY int
+		for _, p := range s.Points {
+			// Points that can't be plotted are left out and the line joins
+			// their neighbours.
+			if !finite(p.X) || !finite(p.Y) {
+				continue
+			}
+			x, y := f.x(p.X), f.y(p.Y)
+			if drawn {
+				c.Line(prevX, prevY, x, y, 2, col)
+			}
+			if len(s.Points) <= 40 {
+				c.Rect(x-2, y-2, 5, 5, col)
+			}
+			drawn, prevX, prevY = true, x, y
+		}
+
+		if legend {
+			x := Width - legendW
+			y := f.top + i*(canvas.TextHeight(scale)+10)
+			c.Rect(x, y, 14, canvas.TextHeight(scale), col)
+			c.Text(x+20, y, s.Name, scale, foreground)
+		}
+	}
+	return c.PNG()
+}
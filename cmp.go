@@ -0,0 +1,479 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	cmpQualified = "Qualified"
+	cmpBubble    = "Bubble"
+	cmpOut       = "Out"
+
+	// cmpBubbleWidth is how many spots either side of the cutoff count as on
+	// the bubble before the district championship is over.
+	cmpBubbleWidth = 5
+)
+
+// cmpEntry is one team's championship qualification status.
+type cmpEntry struct {
+	Team   string
+	Rank   int
+	Points int
+	Status string
+	Reason string
+}
+
+// cmpStandings is a district's championship qualification picture.
+type cmpStandings struct {
+	District string
+	Slots    int
+	Autos    int
+	Cutoff   int
+	Final    bool
+	DCMP     *tbaEvent
+	Entries  []*cmpEntry
+	byTeam   map[string]*cmpEntry
+}
+
+func isDistrictCmp(e *tbaEvent) bool {
+	return e.EventType == eventDistrictCmp || e.EventType == eventDistrictCmpDivision
+}
+
+// cmpSlotDefaults is each district's championship slot allocation, used
+// unless a server has set its own with `cmp slots`. Districts missing here
+// show only automatic qualifiers until they are set.
+var cmpSlotDefaults = map[string]int{
+	"2026chs": 21,
+	"2026fim": 80,
+	"2026fin": 11,
+	"2026fit": 42,
+	"2026fma": 23,
+	"2026fnc": 15,
+	"2026isr": 11,
+	"2026ne":  37,
+	"2026ont": 27,
+	"2026pch": 17,
+	"2026pnw": 26,
+}
+
+// cmpSlots returns how many championship slots a district has for a guild:
+// the guild's own setting, else the shipped default, else 0.
+func cmpSlots(guild, district string) (int, error) {
+	var slots int
+	err := db.QueryRow("SELECT Slots FROM Cmp_Slots WHERE Guild = $1 AND District = $2", guild, district).Scan(&slots)
+	if err == sql.ErrNoRows {
+		return cmpSlotDefaults[district], nil
+	}
+	return slots, err
+}
+
+// setCmpSlots overrides a district's slots for one guild. 0 goes back to the
+// default.
+func setCmpSlots(guild, district string, slots int) error {
+	if slots == 0 {
+		_, err := db.Exec("DELETE FROM Cmp_Slots WHERE Guild = $1 AND District = $2", guild, district)
+		return err
+	}
+	_, err := db.Exec(`INSERT INTO Cmp_Slots (Guild, District, Slots) VALUES ($1, $2, $3)
+		ON CONFLICT (Guild, District) DO UPDATE SET Slots = $3`, guild, district, slots)
+	return err
+}
+
+// districtCmpStandings works out who has qualified for the championship from
+// a district. Impact, Engineering Inspiration and Rookie All Star at the
+// district championship and its winning alliance qualify automatically, and
+// the remaining slots, as the guild sees them, go down the district rankings.
+func districtCmpStandings(guild, district string) (*cmpStandings, error) {
+	rankings, err := tbaDistrictRankings(district)
+	if err == errTBANotFound || (err == nil && len(rankings) == 0) {
+		return nil, commandError(fmt.Sprintf("TBA doesn't have rankings for the %s district.", district))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := tbaDistrictEvents(district)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+
+	s := &cmpStandings{District: district, byTeam: map[string]*cmpEntry{}}
+	autos := map[string]string{}
+	for i := range events {
+		e := &events[i]
+		if !isDistrictCmp(e) {
+			continue
+		}
+		if e.EventType == eventDistrictCmp {
+			s.DCMP = e
+		}
+
+		awards, err := tbaEventAwards(e.Key)
+		if err = ignoreNotFound(err); err != nil {
+			return nil, err
+		}
+		for _, award := range awards {
+			reason := ""
+			switch award.AwardType {
+			case awardChairmans:
+				reason = "Impact"
+			case awardEngineeringInspiration:
+				reason = "Engineering Inspiration"
+			case awardRookieAllStar:
+				reason = "Rookie All Star"
+			case awardWinner:
+				if e.EventType == eventDistrictCmp {
+					reason = "DCMP winner"
+					s.Final = true
+				}
+			}
+			if reason == "" {
+				continue
+			}
+			for _, recipient := range award.RecipientList {
+				if recipient.TeamKey != "" && autos[recipient.TeamKey] == "" {
+					autos[recipient.TeamKey] = reason
+				}
+			}
+		}
+	}
+
+	if s.Slots, err = cmpSlots(guild, district); err != nil {
+		return nil, err
+	}
+	s.Autos = len(autos)
+	remaining := s.Slots - len(autos)
+
+	pos := 0
+	for _, r := range rankings {
+		entry := &cmpEntry{Team: r.TeamKey, Rank: r.Rank, Points: r.PointTotal}
+		s.Entries = append(s.Entries, entry)
+		s.byTeam[r.TeamKey] = entry
+
+		if reason, ok := autos[r.TeamKey]; ok {
+			entry.Status, entry.Reason = cmpQualified, reason
+			continue
+		}
+		if s.Slots == 0 {
+			continue
+		}
+
+		pos++
+		if pos == remaining {
+			s.Cutoff = r.PointTotal
+		}
+		switch {
+		case s.Final && pos <= remaining:
+			entry.Status, entry.Reason = cmpQualified, "District points"
+		case s.Final:
+			entry.Status = cmpOut
+		case pos <= remaining-cmpBubbleWidth:
+			entry.Status, entry.Reason = cmpQualified, "District points"
+		case pos <= remaining+cmpBubbleWidth:
+			entry.Status = cmpBubble
+		default:
+			entry.Status = cmpOut
+		}
+	}
+	return s, nil
+}
+
+// status describes an entry, noting when it could still change.
+func (s *cmpStandings) status(entry *cmpEntry) string {
+	switch {
+	case entry.Status == "":
+		return "Unknown"
+	case entry.Reason != "" && entry.Reason != "District points":
+		return fmt.Sprintf("%s (%s)", entry.Status, entry.Reason)
+	case !s.Final:
+		return entry.Status + " (projected)"
+	}
+	return entry.Status
+}
+
+func (s *cmpStandings) footer() string {
+	switch {
+	case s.Slots == 0:
+		return "This district's slot allocation hasn't been set, so only automatic qualifiers are known"
+	case s.Final:
+		return "Final: the district championship is over"
+	}
+	return "Projected from current district points until the district championship is over"
+}
+
+func (s *cmpStandings) embed() *discordgo.MessageEmbed {
+	var autos, qualified, bubble []string
+	for _, entry := range s.Entries {
+		team := strings.TrimPrefix(entry.Team, "frc")
+		switch {
+		case entry.Status == cmpQualified && entry.Reason != "District points":
+			autos = append(autos, fmt.Sprintf("%s (%s)", team, entry.Reason))
+		case entry.Status == cmpQualified:
+			qualified = append(qualified, team)
+		case entry.Status == cmpBubble:
+			bubble = append(bubble, fmt.Sprintf("%d. %s - %d pts", entry.Rank, team, entry.Points))
+		}
+	}
+
+	slots := "unknown"
+	if s.Slots > 0 {
+		slots = fmt.Sprintf("%d (%d automatic)", s.Slots, s.Autos)
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: s.District + " championship qualification",
+		URL:   "https://www.thebluealliance.com/events/" + s.District[4:] + "/" + s.District[:4] + "#rankings",
+		Color: tbaColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Slots", Value: slots, Inline: true},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: s.footer()},
+	}
+	if s.Cutoff > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Cutoff", Value: fmt.Sprintf("%d pts", s.Cutoff), Inline: true})
+	}
+	if s.DCMP != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "District championship", Value: s.DCMP.Name, Inline: true})
+	}
+
+	embed.Fields = append(embed.Fields,
+		&discordgo.MessageEmbedField{Name: "Automatic", Value: truncate(orNone(strings.Join(autos, "\n")), 1024)},
+		&discordgo.MessageEmbedField{Name: "By district points", Value: truncate(orNone(strings.Join(qualified, ", ")), 1024)},
+	)
+	if len(bubble) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Bubble", Value: truncate(strings.Join(bubble, "\n"), 1024)})
+	}
+	return embed
+}
+
+func cmpTeam(ctx *commandContext, team string) error {
+	year := time.Now().Year()
+	districts, err := tbaTeamDistricts(team)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+
+	district := ""
+	for _, d := range districts {
+		if d.Year == year {
+			district = d.Key
+		}
+	}
+	if district == "" {
+		return commandError(fmt.Sprintf("Team %s isn't in a district this season. Regional teams qualify through regional awards and wins.", team))
+	}
+
+	s, err := districtCmpStandings(ctx.guild, district)
+	if err != nil {
+		return err
+	}
+	entry := s.byTeam[teamKey(team)]
+	if entry == nil {
+		return commandError(fmt.Sprintf("Team %s isn't in the %s district rankings yet.", team, district))
+	}
+
+	color := tbaColor
+	switch entry.Status {
+	case cmpQualified:
+		color = 0x4caf50
+	case cmpBubble:
+		color = 0xffc107
+	case cmpOut:
+		color = 0x9e9e9e
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "Status", Value: s.status(entry)},
+		{Name: "District rank", Value: fmt.Sprintf("%d", entry.Rank), Inline: true},
+		{Name: "Points", Value: fmt.Sprintf("%d", entry.Points), Inline: true},
+	}
+	if s.Cutoff > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Cutoff", Value: fmt.Sprintf("%d pts", s.Cutoff), Inline: true})
+	}
+
+	_, err = ctx.replyEmbed(&discordgo.MessageEmbed{
+		Title:  fmt.Sprintf("Team %s championship qualification", team),
+		URL:    "https://www.thebluealliance.com/team/" + team,
+		Color:  color,
+		Fields: fields,
+		Footer: &discordgo.MessageEmbedFooter{Text: s.footer()},
+	})
+	return err
+}
+
+func cmpFollow(ctx *commandContext, follow bool) error {
+	if !isAdmin(ctx.dg, ctx.msg) {
+		return commandError("Only server admins can set up the championship digest.")
+	}
+	if ctx.guild == "" {
+		return commandError("Only server channels can get the digest.")
+	}
+	if !ctx.has("district") {
+		return usageError("give the district, like fim")
+	}
+	abbr := strings.ToLower(ctx.str("district"))
+
+	if !follow {
+		res, err := db.Exec("DELETE FROM Follows WHERE Channel = $1 AND Kind = $2 AND Target = $3", ctx.msg.ChannelID, followCmp, abbr)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return commandError(fmt.Sprintf("This channel doesn't get the %s digest.", abbr))
+		}
+		_, err = ctx.reply(fmt.Sprintf("This channel no longer gets the %s championship digest.", abbr))
+		return err
+	}
+
+	if _, err := tbaDistrictRankings(districtKey(abbr)); err == errTBANotFound {
+		return commandError(fmt.Sprintf("TBA doesn't know about the %s district.", abbr))
+	}
+
+	_, err := db.Exec(`INSERT INTO Follows (Channel, Guild, Kind, Target, Created_At) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (Channel, Kind, Target) DO NOTHING`, ctx.msg.ChannelID, ctx.guild, followCmp, abbr, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = ctx.reply(fmt.Sprintf("This channel will get a daily %s championship digest during district championship weeks.", abbr))
+	return err
+}
+
+// cmpSetSlots sets how many championship slots a district has in this
+// server, which decides who is qualified or on the bubble.
+func cmpSetSlots(ctx *commandContext) error {
+	if ctx.guild == "" {
+		return commandError("Championship slots are set per server, so use this in a server channel.")
+	}
+	if !isAdmin(ctx.dg, ctx.msg) {
+		return commandError("Only server admins can set championship slots.")
+	}
+	if !ctx.has("district") || !ctx.has("slots") {
+		return usageError("give the district and its slot count, like `cmp slots fim 80`")
+	}
+	slots := ctx.num("slots")
+	if slots < 0 || slots > 1000 {
+		return commandError("The slot count must be between 0 and 1000.")
+	}
+
+	district := districtKey(ctx.str("district"))
+	if _, err := tbaDistrictRankings(district); err == errTBANotFound {
+		return commandError(fmt.Sprintf("TBA doesn't know about the %s district.", district))
+	}
+	if err := setCmpSlots(ctx.guild, district, slots); err != nil {
+		return err
+	}
+	if slots == 0 {
+		slots = cmpSlotDefaults[district]
+	}
+	_, err := ctx.reply(fmt.Sprintf("%s has %d championship slots in this server.", district, slots))
+	return err
+}
+
+// cmpDigest posts each followed district's standings while its district
+// championship is coming up or underway.
+func cmpDigest() {
+	if session == nil {
+		return
+	}
+
+	rows, err := db.Query("SELECT Channel, Guild, Target FROM Follows WHERE Kind = $1", followCmp)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	// Slots can differ by guild, so followers are grouped by both.
+	channels := map[string]map[string][]string{}
+	for rows.Next() {
+		var channel, guild, abbr string
+		if err = rows.Scan(&channel, &guild, &abbr); err != nil {
+			log.Println(err)
+			break
+		}
+		if channels[abbr] == nil {
+			channels[abbr] = map[string][]string{}
+		}
+		channels[abbr][guild] = append(channels[abbr][guild], channel)
+	}
+	rows.Close()
+
+	now := time.Now()
+	for abbr, guilds := range channels {
+		district := districtKey(abbr)
+		events, err := tbaDistrictEvents(district)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		active := false
+		for i := range events {
+			start, end := events[i].dates()
+			if isDistrictCmp(&events[i]) && now.After(start.AddDate(0, 0, -7)) && now.Before(end.AddDate(0, 0, 2)) {
+				active = true
+			}
+		}
+		if !active {
+			continue
+		}
+
+		for guild, targets := range guilds {
+			s, err := districtCmpStandings(guild, district)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			embed := s.embed()
+			for _, channel := range targets {
+				if _, err = session.ChannelMessageSendEmbed(channel, embed); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func cmpCommand(ctx *commandContext) error {
+	target := strings.ToLower(ctx.str("target"))
+	switch target {
+	case "follow", "unfollow":
+		return cmpFollow(ctx, target == "follow")
+	case "slots":
+		return cmpSetSlots(ctx)
+	}
+	if ctx.has("district") {
+		return usageError("only `cmp follow`, `cmp unfollow` and `cmp slots` take a district")
+	}
+
+	if team, err := convertArg(argSpec{name: "team", kind: argTeam}, target); err == nil {
+		return cmpTeam(ctx, team.(string))
+	}
+
+	s, err := districtCmpStandings(ctx.guild, districtKey(target))
+	if err != nil {
+		return err
+	}
+	_, err = ctx.replyEmbed(s.embed())
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "cmp",
+		aliases: []string{"champs"},
+		summary: "Track who is qualifying for the championship from a district.",
+		help: "`cmp 254` shows a team's status, `cmp fim` a district's qualifiers and bubble. " +
+			"Admins can use `cmp follow fim` for a daily digest in this channel during district championship weeks, " +
+			"and `cmp slots fim 80` to set a district's championship slots for this server, or `cmp slots fim 0` to go back to the default.",
+		args: []argSpec{
+			{name: "target"},
+			{name: "district", optional: true},
+			{name: "slots", kind: argInt, optional: true},
+		},
+		run: cmpCommand,
+	})
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// argKind determines how a raw argument is validated and converted.
+type argKind int
+
+const (
+	argWord  argKind = iota // a single token
+	argInt                  // a base 10 integer
+	argTeam                 // a team number, with or without the "frc" prefix
+	argEvent                // an event key such as 2019casj
+	argText                 // everything left on the line
+	argBool                 // a flag that takes no value
+)
+
+// argSpec describes a single positional argument or --flag of a command.
+type argSpec struct {
+	name     string
+	kind     argKind
+	optional bool
+}
+
+// command is a single entry in the command registry.
+type command struct {
+	name    string
+	aliases []string
+	summary string
+	help    string
+	args    []argSpec
+	flags   []argSpec
+	admin   bool
+	run     func(ctx *commandContext) error
+}
+
+// commandContext carries everything a command needs to respond to a message.
+type commandContext struct {
+	dg       *discordgo.Session
+	msg      *discordgo.MessageCreate
+	guild    string
+	prefix   string
+	settings *guildSettings
+	cmd      *command
+	values   map[string]interface{}
+}
+
+// commandError is an error that should be shown to the user as-is.
+type commandError string
+
+func (e commandError) Error() string { return string(e) }
+
+// usageError is returned when a command's arguments fail to parse.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// listener is a handler for messages that don't start with the command
+// prefix, such as [[team]] lookups and draft proposals.
+type listener func(dg *discordgo.Session, msg *discordgo.MessageCreate)
+
+var (
+	commands  = map[string]*command{}
+	aliases   = map[string]*command{}
+	listeners []listener
+)
+
+func registerCommand(cmd *command) {
+	if _, ok := aliases[cmd.name]; ok {
+		log.Fatalf("command %s registered twice", cmd.name)
+	}
+
+	commands[cmd.name] = cmd
+	aliases[cmd.name] = cmd
+	for _, alias := range cmd.aliases {
+		if _, ok := aliases[alias]; ok {
+			log.Fatalf("alias %s of %s already registered", alias, cmd.name)
+		}
+		aliases[alias] = cmd
+	}
+}
+
+func registerListener(l listener) {
+	listeners = append(listeners, l)
+}
+
+// handleMessage is the only MessageCreate handler. It drops the bot's own
+// messages and dispatches to either a command or the plain listeners. A
+// prefixed message that doesn't name a command goes to the listeners.
+func handleMessage(dg *discordgo.Session, msg *discordgo.MessageCreate) {
+	if msg.Author == nil || msg.Author.ID == dg.State.User.ID || msg.Author.Bot {
+		return
+	}
+
+	guild := messageGuild(dg, msg.ChannelID)
+	settings := guildSettingsFor(guild)
+	if strings.HasPrefix(msg.Content, settings.Prefix) && runCommand(dg, msg, guild, settings) {
+		return
+	}
+
+	if !settings.channelAllowed(msg.ChannelID) {
+		return
+	}
+
+	for _, l := range listeners {
+		l(dg, msg)
+	}
+}
+
+// runCommand runs the command a prefixed message names. It reports whether
+// the message named a command at all, so other prefixed messages still reach
+// the listeners.
+func runCommand(dg *discordgo.Session, msg *discordgo.MessageCreate, guild string, settings *guildSettings) bool {
+	prefix := settings.Prefix
+	tokens := tokenize(strings.TrimPrefix(msg.Content, prefix))
+	if len(tokens) == 0 {
+		return false
+	}
+
+	cmd, ok := aliases[strings.ToLower(tokens[0])]
+	if !ok {
+		return false
+	}
+
+	// Admins can always run commands so a bad allowed channel list can be fixed.
+	if !settings.channelAllowed(msg.ChannelID) && !isAdmin(dg, msg) {
+		return true
+	}
+
+	ctx := &commandContext{
+		dg:       dg,
+		msg:      msg,
+		guild:    guild,
+		prefix:   prefix,
+		settings: settings,
+		cmd:      cmd,
+	}
+
+	if cmd.admin && !isAdmin(dg, msg) {
+		ctx.replyError(commandError("Only server admins can use `" + prefix + cmd.name + "`."))
+		return true
+	}
+
+	values, err := parseArgs(cmd, tokens[1:])
+	if err != nil {
+		ctx.replyError(err)
+		return true
+	}
+	ctx.values = values
+
+	if err = cmd.run(ctx); err != nil {
+		ctx.replyError(err)
+	}
+	return true
+}
+
+// tokenize splits a command line on whitespace, keeping "quoted strings"
+// together.
+func tokenize(line string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+func parseArgs(cmd *command, tokens []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+
+	var positional []string
+	for i := 0; i < len(tokens); i++ {
+		if !strings.HasPrefix(tokens[i], "--") || len(tokens[i]) == 2 {
+			positional = append(positional, tokens[i])
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimPrefix(tokens[i], "--"))
+		var spec *argSpec
+		for j := range cmd.flags {
+			if cmd.flags[j].name == name {
+				spec = &cmd.flags[j]
+			}
+		}
+		if spec == nil {
+			return nil, usageError(fmt.Sprintf("unknown flag --%s", name))
+		}
+
+		if spec.kind == argBool {
+			values[name] = true
+			continue
+		}
+		if i+1 >= len(tokens) {
+			return nil, usageError(fmt.Sprintf("--%s needs a value", name))
+		}
+		i++
+		value, err := convertArg(*spec, tokens[i])
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+
+	for i, spec := range cmd.args {
+		if i >= len(positional) {
+			if !spec.optional {
+				return nil, usageError(fmt.Sprintf("missing <%s>", spec.name))
+			}
+			continue
+		}
+
+		raw := positional[i]
+		if spec.kind == argText {
+			raw = strings.Join(positional[i:], " ")
+			positional = positional[:i+1]
+		}
+
+		value, err := convertArg(spec, raw)
+		if err != nil {
+			return nil, err
+		}
+		values[spec.name] = value
+	}
+
+	if len(positional) > len(cmd.args) {
+		return nil, usageError("too many arguments")
+	}
+
+	return values, nil
+}
+
+func convertArg(spec argSpec, raw string) (interface{}, error) {
+	switch spec.kind {
+	case argInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, usageError(fmt.Sprintf("<%s> must be a number, not %q", spec.name, raw))
+		}
+		return n, nil
+	case argTeam:
+		team := strings.TrimPrefix(strings.ToLower(raw), "frc")
+		if _, err := strconv.Atoi(team); err != nil {
+			return nil, usageError(fmt.Sprintf("<%s> must be a team number, not %q", spec.name, raw))
+		}
+		return team, nil
+	case argEvent:
+		event := strings.ToLower(raw)
+		if !eventKeyRegex.MatchString(event) {
+			return nil, usageError(fmt.Sprintf("<%s> must be an event key like 2019casj, not %q", spec.name, raw))
+		}
+		return event, nil
+	}
+	return raw, nil
+}
+
+func (ctx *commandContext) has(name string) bool {
+	_, ok := ctx.values[name]
+	return ok
+}
+
+func (ctx *commandContext) str(name string) string {
+	s, _ := ctx.values[name].(string)
+	return s
+}
+
+func (ctx *commandContext) num(name string) int {
+	n, _ := ctx.values[name].(int)
+	return n
+}
+
+func (ctx *commandContext) flag(name string) bool {
+	b, _ := ctx.values[name].(bool)
+	return b
+}
+
+func (ctx *commandContext) reply(content string) (*discordgo.Message, error) {
+	return ctx.dg.ChannelMessageSend(ctx.msg.ChannelID, content)
+}
+
+func (ctx *commandContext) replyEmbed(embed *discordgo.MessageEmbed) (*discordgo.Message, error) {
+	return ctx.dg.ChannelMessageSendEmbed(ctx.msg.ChannelID, embed)
+}
+
+// replyError reports a failed command to the channel. User facing errors are
+// shown verbatim, anything else is logged and replaced by a generic message.
+func (ctx *commandContext) replyError(err error) {
+	switch e := err.(type) {
+	case usageError:
+		ctx.reply(fmt.Sprintf(":warning: %s\nUsage: `%s`", string(e), ctx.cmd.usage(ctx.prefix)))
+	case commandError:
+		ctx.reply(":warning: " + string(e))
+	default:
+		log.Printf("%s: %#v\n", ctx.cmd.name, err)
+		ctx.reply(fmt.Sprintf(":x: Something went wrong running `%s%s`.", ctx.prefix, ctx.cmd.name))
+	}
+}
+
+func (cmd *command) usage(prefix string) string {
+	parts := []string{prefix + cmd.name}
+	for _, spec := range cmd.args {
+		name := spec.name
+		if spec.kind == argText {
+			name += "..."
+		}
+		if spec.optional {
+			parts = append(parts, "["+name+"]")
+		} else {
+			parts = append(parts, "<"+name+">")
+		}
+	}
+	for _, spec := range cmd.flags {
+		if spec.kind == argBool {
+			parts = append(parts, "[--"+spec.name+"]")
+		} else {
+			parts = append(parts, "[--"+spec.name+" "+spec.name+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// messageGuild returns the guild a channel belongs to, or "" for DMs.
+func messageGuild(dg *discordgo.Session, channelID string) string {
+	if ch, err := dg.State.Channel(channelID); err == nil {
+		return ch.GuildID
+	}
+	if ch, err := dg.Channel(channelID); err == nil {
+		return ch.GuildID
+	}
+	return ""
+}
+
+func isAdmin(dg *discordgo.Session, msg *discordgo.MessageCreate) bool {
+	perms, err := dg.State.UserChannelPermissions(msg.Author.ID, msg.ChannelID)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0
+}
+
+func helpCommand(ctx *commandContext) error {
+	if ctx.has("command") {
+		cmd, ok := aliases[strings.ToLower(strings.TrimPrefix(ctx.str("command"), ctx.prefix))]
+		if !ok {
+			return commandError(fmt.Sprintf("There's no command called `%s`.", ctx.str("command")))
+		}
+
+		embed := &discordgo.MessageEmbed{
+			Title:       ctx.prefix + cmd.name,
+			Description: cmd.summary,
+			Fields: []*discordgo.MessageEmbedField{
+				{Name: "Usage", Value: "`" + cmd.usage(ctx.prefix) + "`"},
+			},
+		}
+		if cmd.help != "" {
+			embed.Description += "\n\n" + cmd.help
+		}
+		if len(cmd.aliases) > 0 {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  "Aliases",
+				Value: ctx.prefix + strings.Join(cmd.aliases, ", "+ctx.prefix),
+			})
+		}
+		_, err := ctx.replyEmbed(embed)
+		return err
+	}
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		cmd := commands[name]
+		if cmd.admin && !isAdmin(ctx.dg, ctx.msg) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("`%s%s` %s", ctx.prefix, name, cmd.summary))
+	}
+
+	_, err := ctx.replyEmbed(&discordgo.MessageEmbed{
+		Title:       "Commands",
+		Description: strings.Join(lines, "\n"),
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Use %shelp <command> for details.", ctx.prefix),
+		},
+	})
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "help",
+		aliases: []string{"commands", "h"},
+		summary: "List commands, or show how to use one.",
+		args:    []argSpec{{name: "command", optional: true}},
+		run:     helpCommand,
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"team 254", []string{"team", "254"}},
+		{"  team\t254\n--awards ", []string{"team", "254", "--awards"}},
+		{`note 254 "fast intake" ok`, []string{"note", "254", "fast intake", "ok"}},
+		{`say "un"quoted`, []string{"say", "unquoted"}},
+		{`say "never closed`, []string{"say", "never closed"}},
+	}
+	for _, test := range tests {
+		if got := tokenize(test.line); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	cmd := &command{
+		name: "test",
+		args: []argSpec{
+			{name: "team", kind: argTeam},
+			{name: "event", kind: argEvent, optional: true},
+			{name: "note", kind: argText, optional: true},
+		},
+		flags: []argSpec{
+			{name: "year", kind: argInt},
+			{name: "chart", kind: argBool},
+		},
+	}
+
+	tests := []struct {
+		tokens []string
+		want   map[string]interface{}
+	}{
+		{[]string{"frc254"}, map[string]interface{}{"team": "254"}},
+		{[]string{"254", "2019CASJ"}, map[string]interface{}{"team": "254", "event": "2019casj"}},
+		{[]string{"254", "2019casj", "fast", "intake"}, map[string]interface{}{"team": "254", "event": "2019casj", "note": "fast intake"}},
+		{[]string{"--YEAR", "2019", "254", "--chart"}, map[string]interface{}{"team": "254", "year": 2019, "chart": true}},
+		// A bare -- is an ordinary argument.
+		{[]string{"254", "2019casj", "--"}, map[string]interface{}{"team": "254", "event": "2019casj", "note": "--"}},
+	}
+	for _, test := range tests {
+		got, err := parseArgs(cmd, test.tokens)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseArgs(%q) = %v, %v, want %v", test.tokens, got, err, test.want)
+		}
+	}
+
+	for _, tokens := range [][]string{
+		nil,
+		{"abc"},
+		{"254", "casj"},
+		{"254", "--year"},
+		{"254", "--year", "soon"},
+		{"254", "--color", "red"},
+	} {
+		if _, err := parseArgs(cmd, tokens); err == nil {
+			t.Errorf("parseArgs(%q) didn't fail", tokens)
+		} else if _, ok := err.(usageError); !ok {
+			t.Errorf("parseArgs(%q) error = %#v, want a usageError", tokens, err)
+		}
+	}
+
+	short := &command{name: "short", args: []argSpec{{name: "team", kind: argTeam}}}
+	if _, err := parseArgs(short, []string{"254", "1678"}); err == nil {
+		t.Error("parseArgs with too many arguments didn't fail")
+	}
+}
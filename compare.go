@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const maxCompareTeams = 6
+
+// teamSeason is a team's current season at a glance.
+type teamSeason struct {
+	Team     string
+	Record   h2hRecord
+	AvgScore float64
+	OPR      float64
+	OPREvent string
+	Elo      float64
+	Attended []string
+	Upcoming []string
+	Awards   []tbaAward
+}
+
+// loadTeamSeason gathers a team's record, scores, latest OPR, Elo, events and
+// awards for a season.
+func loadTeamSeason(team string, year int) (*teamSeason, error) {
+	s := &teamSeason{Team: team, Elo: eloRating(teamKey(team))}
+
+	matches, err := teamMatches(team, year)
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	for i := range matches {
+		color := matches[i].allianceOf(teamKey(team))
+		s.Record.add(matches[i].outcome(color))
+		total += matches[i].Alliances[color].Score
+	}
+	if len(matches) > 0 {
+		s.AvgScore = float64(total) / float64(len(matches))
+	}
+
+	events, err := tbaTeamEvents(team, year)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].StartDate < events[j].StartDate })
+	for i := range events {
+		start, _ := events[i].dates()
+		if start.After(time.Now()) {
+			s.Upcoming = append(s.Upcoming, events[i].Key)
+		} else {
+			s.Attended = append(s.Attended, events[i].Key)
+		}
+	}
+
+	// OPR comes from the most recent event with qualification results.
+	for i := len(s.Attended) - 1; i >= 0 && s.OPREvent == ""; i-- {
+		ratings, _, err := eventRatings(s.Attended[i], 0)
+		if _, ok := err.(commandError); ok {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if opr, ok := ratings.OPR[teamKey(team)]; ok {
+			s.OPR, s.OPREvent = opr, s.Attended[i]
+		}
+	}
+
+	s.Awards, err = tbaTeamYearAwards(team, year)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func compareCommand(ctx *commandContext) error {
+	keys, err := parseTeamList(ctx.str("teams"))
+	if err != nil {
+		return err
+	}
+	if len(keys) < 2 || len(keys) > maxCompareTeams {
+		return usageError(fmt.Sprintf("compare 2 to %d teams", maxCompareTeams))
+	}
+
+	year := time.Now().Year()
+	if ctx.has("year") {
+		year = ctx.num("year")
+	}
+
+	seasons := make([]*teamSeason, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, team string) {
+			defer wg.Done()
+			seasons[i], errs[i] = loadTeamSeason(team, year)
+		}(i, strings.TrimPrefix(key, "frc"))
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	row := func(label string, value func(s *teamSeason) string) string {
+		line := fmt.Sprintf("%-9s", label)
+		for _, s := range seasons {
+			line += fmt.Sprintf(" %8s", value(s))
+		}
+		return line
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("```\n")
+	for _, line := range []string{
+		row("", func(s *teamSeason) string { return s.Team }),
+		row("Record", func(s *teamSeason) string { return s.Record.String() }),
+		row("Avg score", func(s *teamSeason) string {
+			if s.Record.matches() == 0 {
+				return "-"
+			}
+			return fmt.Sprintf("%.1f", s.AvgScore)
+		}),
+		row("OPR", func(s *teamSeason) string {
+			if s.OPREvent == "" {
+				return "-"
+			}
+			return fmt.Sprintf("%.1f", s.OPR)
+		}),
+		row("Elo", func(s *teamSeason) string { return fmt.Sprintf("%.0f", s.Elo) }),
+		row("Events", func(s *teamSeason) string { return fmt.Sprintf("%d", len(s.Attended)) }),
+		row("Awards", func(s *teamSeason) string { return fmt.Sprintf("%d", len(s.Awards)) }),
+		row("Banners", func(s *teamSeason) string {
+			banners := 0
+			for _, award := range s.Awards {
+				if blueBannerAwards[award.AwardType] {
+					banners++
+				}
+			}
+			return fmt.Sprintf("%d", banners)
+		}),
+	} {
+		buf.WriteString(line + "\n")
+	}
+	buf.WriteString("```")
+
+	var events, awards []string
+	for _, s := range seasons {
+		played := orNone(strings.Join(s.Attended, ", "))
+		next := orNone(strings.Join(s.Upcoming, ", "))
+		events = append(events, fmt.Sprintf("**%s** %s • next: %s", s.Team, played, next))
+
+		var names []string
+		for _, award := range s.Awards {
+			names = append(names, fmt.Sprintf("%s (%s)", award.Name, award.EventKey))
+		}
+		if len(names) > 0 {
+			awards = append(awards, fmt.Sprintf("**%s** %s", s.Team, strings.Join(names, ", ")))
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("%d comparison", year),
+		Color:       tbaColor,
+		Description: buf.String(),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Events", Value: truncate(strings.Join(events, "\n"), 1024)},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: "Records are W-L-T • OPR is from each team's latest event • Elo is current"},
+	}
+	if len(awards) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Awards", Value: truncate(strings.Join(awards, "\n"), 1024)})
+	}
+
+	_, err = ctx.replyEmbed(embed)
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "compare",
+		aliases: []string{"vs"},
+		summary: "Compare up to 6 teams' seasons side by side.",
+		help:    "`compare 254 1678 971` shows record, average score, OPR, Elo, events and awards. Use --year for another season.",
+		args:    []argSpec{{name: "teams", kind: argText}},
+		flags:   []argSpec{{name: "year", kind: argInt}},
+		run:     compareCommand,
+	})
+}
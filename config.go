@@ -0,0 +1,540 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// guildSettings is the per-guild configuration stored in Guild_Settings.
+// Values handed out by guildSettingsFor are shared and must not be modified.
+type guildSettings struct {
+	Guild           string
+	Prefix          string
+	Timezone        string
+	DraftCategory   string
+	PublicDrafts    bool
+	ChannelTemplate string
+	RoleTemplate    string
+	MentionLookups  bool
+	AllowedChannels []string
+	NotifyChannel   string
+	ReminderMinutes int
+	ArchiveCategory string
+	ArchiveMode     string
+	CleanupDays     int
+	SignupEmoji     string
+	MaxDrafters     int
+	ScoutRole       string
+}
+
+// setting describes a single key of the !config command.
+type setting struct {
+	key         string
+	description string
+	def         string
+	show        func(s *guildSettings) string
+	set         func(dg *discordgo.Session, s *guildSettings, value string) error
+}
+
+var (
+	selectSettings = "SELECT Prefix, Timezone, Draft_Category, Channel_Template, Role_Template, Mention_Lookups, Allowed_Channels, Notify_Channel, Reminder_Minutes, Public_Drafts, Archive_Category, Archive_Mode, Cleanup_Days, Signup_Emoji, Max_Drafters, Scout_Role FROM Guild_Settings WHERE Guild = $1"
+	upsertSettings = `INSERT INTO Guild_Settings (Guild, Prefix, Timezone, Draft_Category, Channel_Template, Role_Template, Mention_Lookups, Allowed_Channels, Notify_Channel, Reminder_Minutes, Public_Drafts, Archive_Category, Archive_Mode, Cleanup_Days, Signup_Emoji, Max_Drafters, Scout_Role)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		ON CONFLICT (Guild) DO UPDATE SET Prefix = $2, Timezone = $3, Draft_Category = $4, Channel_Template = $5, Role_Template = $6, Mention_Lookups = $7, Allowed_Channels = $8, Notify_Channel = $9, Reminder_Minutes = $10, Public_Drafts = $11, Archive_Category = $12, Archive_Mode = $13, Cleanup_Days = $14, Signup_Emoji = $15, Max_Drafters = $16, Scout_Role = $17`
+	channelMentionRegex = regexp.MustCompile(`^<#(\d+)>$|^(\d+)$`)
+	roleMentionRegex    = regexp.MustCompile(`^<@&(\d+)>$|^(\d+)$`)
+	settingsCache       = map[string]*guildSettings{}
+	settingsMutex       = &sync.RWMutex{}
+	settingKeys         []*setting
+)
+
+func init() {
+	settingKeys = []*setting{
+		{
+			key:         "prefix",
+			description: "Command prefix",
+			def:         "!",
+			show:        func(s *guildSettings) string { return "`" + s.Prefix + "`" },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				if value == "" || len(value) > 5 || strings.ContainsAny(value, " \t\n") {
+					return commandError("Prefixes must be 1 to 5 characters with no spaces.")
+				}
+				s.Prefix = value
+				return nil
+			},
+		},
+		{
+			key:         "timezone",
+			description: "Timezone for draft dates and match times",
+			def:         "UTC",
+			show:        func(s *guildSettings) string { return s.Timezone },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				if _, err := time.LoadLocation(value); err != nil {
+					return commandError(fmt.Sprintf("%q isn't a timezone I know. Try something like America/New_York.", value))
+				}
+				s.Timezone = value
+				return nil
+			},
+		},
+		{
+			key:         "category",
+			description: "Category new draft channels are created under",
+			def:         "none",
+			show:        func(s *guildSettings) string { return showChannel(s.DraftCategory) },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) (err error) {
+				s.DraftCategory, err = parseChannel(dg, s.Guild, value, discordgo.ChannelTypeGuildCategory)
+				return err
+			},
+		},
+		{
+			key:         "public-drafts",
+			description: "Whether everyone can read draft channels",
+			def:         "on",
+			show:        func(s *guildSettings) string { return showBool(s.PublicDrafts) },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) (err error) {
+				s.PublicDrafts, err = parseBool(value)
+				return err
+			},
+		},
+		{
+			key:         "archive-category",
+			description: "Category finished draft channels are moved to",
+			def:         "none",
+			show:        func(s *guildSettings) string { return showChannel(s.ArchiveCategory) },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) (err error) {
+				s.ArchiveCategory, err = parseChannel(dg, s.Guild, value, discordgo.ChannelTypeGuildCategory)
+				return err
+			},
+		},
+		{
+			key:         "archive-mode",
+			description: "What happens to finished draft channels: archive or delete",
+			def:         "archive",
+			show:        func(s *guildSettings) string { return s.ArchiveMode },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				value = strings.ToLower(value)
+				if value != "archive" && value != "delete" {
+					return commandError("The archive mode must be archive or delete.")
+				}
+				s.ArchiveMode = value
+				return nil
+			},
+		},
+		{
+			key:         "cleanup-days",
+			description: "Days after a draft starts that it is cleaned up, 0 to never",
+			def:         "7",
+			show:        func(s *guildSettings) string { return strconv.Itoa(s.CleanupDays) + " days" },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				days, err := strconv.Atoi(value)
+				if err != nil || days < 0 || days > 365 {
+					return commandError("Cleanup must be a number of days, up to a year.")
+				}
+				s.CleanupDays = days
+				return nil
+			},
+		},
+		{
+			key:         "signup-emoji",
+			description: "Reaction used to sign up for a draft",
+			def:         "✅",
+			show:        func(s *guildSettings) string { return showEmoji(s.SignupEmoji) },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				if strings.ContainsAny(value, " \t\n") {
+					return commandError("The sign-up emoji must be a single emoji.")
+				}
+				s.SignupEmoji = parseEmoji(value)
+				return nil
+			},
+		},
+		{
+			key:         "max-drafters",
+			description: "Most people that can sign up for a draft, 0 for no limit",
+			def:         "0",
+			show: func(s *guildSettings) string {
+				if s.MaxDrafters == 0 {
+					return "no limit"
+				}
+				return strconv.Itoa(s.MaxDrafters)
+			},
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 || n > 250 {
+					return commandError("The maximum number of drafters must be between 0 and 250.")
+				}
+				s.MaxDrafters = n
+				return nil
+			},
+		},
+		{
+			key:         "channel-name",
+			description: "Name of new draft channels, {name} is the draft name",
+			def:         "draft-{name}",
+			show:        func(s *guildSettings) string { return "`" + s.ChannelTemplate + "`" },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				if !strings.Contains(value, "{name}") {
+					return commandError("The channel name must contain {name}.")
+				}
+				s.ChannelTemplate = value
+				return nil
+			},
+		},
+		{
+			key:         "role-name",
+			description: "Name of the role given to drafters, {name} is the draft name",
+			def:         "{name} Drafter",
+			show:        func(s *guildSettings) string { return "`" + s.RoleTemplate + "`" },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				if !strings.Contains(value, "{name}") {
+					return commandError("The role name must contain {name}.")
+				}
+				s.RoleTemplate = value
+				return nil
+			},
+		},
+		{
+			key:         "lookups",
+			description: "Whether [[team]] mentions are answered",
+			def:         "on",
+			show:        func(s *guildSettings) string { return showBool(s.MentionLookups) },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) (err error) {
+				s.MentionLookups, err = parseBool(value)
+				return err
+			},
+		},
+		{
+			key:         "channels",
+			description: "Channels the bot responds in",
+			def:         "all",
+			show: func(s *guildSettings) string {
+				if len(s.AllowedChannels) == 0 {
+					return "all"
+				}
+				var shown []string
+				for _, ch := range s.AllowedChannels {
+					shown = append(shown, showChannel(ch))
+				}
+				return strings.Join(shown, " ")
+			},
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				s.AllowedChannels = nil
+				if value == "all" {
+					return nil
+				}
+				for _, field := range strings.Fields(value) {
+					ch, err := parseChannel(dg, s.Guild, field, discordgo.ChannelTypeGuildText)
+					if err != nil {
+						return err
+					}
+					s.AllowedChannels = append(s.AllowedChannels, ch)
+				}
+				return nil
+			},
+		},
+		{
+			key:         "notify-channel",
+			description: "Default channel for announcements",
+			def:         "none",
+			show:        func(s *guildSettings) string { return showChannel(s.NotifyChannel) },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) (err error) {
+				s.NotifyChannel, err = parseChannel(dg, s.Guild, value, discordgo.ChannelTypeGuildText)
+				return err
+			},
+		},
+		{
+			key:         "reminder",
+			description: "Minutes before a draft that reminders are sent",
+			def:         "30",
+			show:        func(s *guildSettings) string { return strconv.Itoa(s.ReminderMinutes) + " minutes" },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) error {
+				minutes, err := strconv.Atoi(value)
+				if err != nil || minutes < 0 || minutes > 7*24*60 {
+					return commandError("The reminder must be a number of minutes, up to a week.")
+				}
+				s.ReminderMinutes = minutes
+				return nil
+			},
+		},
+		{
+			key:         "scout-role",
+			description: "Role that can edit alliance selection do not pick lists and scouting scores",
+			def:         "none",
+			show:        func(s *guildSettings) string { return showRole(s.ScoutRole) },
+			set: func(dg *discordgo.Session, s *guildSettings, value string) (err error) {
+				s.ScoutRole, err = parseRole(dg, s.Guild, value)
+				return err
+			},
+		},
+	}
+
+	registerCommand(&command{
+		name:    "config",
+		aliases: []string{"settings"},
+		summary: "Show or change this server's settings.",
+		help:    "`config` shows every setting, `config set <key> <value>` changes one and `config reset <key>` restores its default.",
+		args: []argSpec{
+			{name: "action", optional: true},
+			{name: "key", optional: true},
+			{name: "value", kind: argText, optional: true},
+		},
+		admin: true,
+		run:   configCommand,
+	})
+}
+
+func defaultSettings(guild string) *guildSettings {
+	s := &guildSettings{Guild: guild}
+	for _, key := range settingKeys {
+		if err := key.set(nil, s, key.def); err != nil {
+			log.Fatalf("default for %s: %v", key.key, err)
+		}
+	}
+	return s
+}
+
+// guildSettingsFor returns the cached settings for a guild, loading them from
+// the database on first use. DMs and unknown guilds get the defaults.
+func guildSettingsFor(guild string) *guildSettings {
+	settingsMutex.RLock()
+	s, ok := settingsCache[guild]
+	settingsMutex.RUnlock()
+	if ok {
+		return s
+	}
+
+	s, err := loadSettings(guild)
+	if err != nil {
+		log.Println(err)
+		return defaultSettings(guild)
+	}
+
+	settingsMutex.Lock()
+	settingsCache[guild] = s
+	settingsMutex.Unlock()
+	return s
+}
+
+func loadSettings(guild string) (*guildSettings, error) {
+	s := defaultSettings(guild)
+	if guild == "" {
+		return s, nil
+	}
+
+	var allowed string
+	err := db.QueryRow(selectSettings, guild).Scan(&s.Prefix, &s.Timezone, &s.DraftCategory, &s.ChannelTemplate,
+		&s.RoleTemplate, &s.MentionLookups, &allowed, &s.NotifyChannel, &s.ReminderMinutes, &s.PublicDrafts,
+		&s.ArchiveCategory, &s.ArchiveMode, &s.CleanupDays, &s.SignupEmoji, &s.MaxDrafters, &s.ScoutRole)
+	if err == sql.ErrNoRows {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if allowed != "" {
+		s.AllowedChannels = strings.Split(allowed, ",")
+	}
+	return s, nil
+}
+
+func saveSettings(s *guildSettings) error {
+	_, err := db.Exec(upsertSettings, s.Guild, s.Prefix, s.Timezone, s.DraftCategory, s.ChannelTemplate,
+		s.RoleTemplate, s.MentionLookups, strings.Join(s.AllowedChannels, ","), s.NotifyChannel, s.ReminderMinutes, s.PublicDrafts,
+		s.ArchiveCategory, s.ArchiveMode, s.CleanupDays, s.SignupEmoji, s.MaxDrafters, s.ScoutRole)
+	if err != nil {
+		return err
+	}
+
+	invalidateSettings(s.Guild)
+	return nil
+}
+
+func invalidateSettings(guild string) {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	delete(settingsCache, guild)
+}
+
+func (s *guildSettings) location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (s *guildSettings) channelAllowed(channelID string) bool {
+	if len(s.AllowedChannels) == 0 {
+		return true
+	}
+	for _, ch := range s.AllowedChannels {
+		if ch == channelID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *guildSettings) channelName(name string) string {
+	return strings.ToLower(strings.Replace(s.ChannelTemplate, "{name}", name, -1))
+}
+
+func (s *guildSettings) roleName(name string) string {
+	return strings.Replace(s.RoleTemplate, "{name}", name, -1)
+}
+
+func showChannel(id string) string {
+	if id == "" {
+		return "none"
+	}
+	return "<#" + id + ">"
+}
+
+func showBool(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "yes", "true", "enabled":
+		return true, nil
+	case "off", "no", "false", "disabled":
+		return false, nil
+	}
+	return false, commandError(fmt.Sprintf("%q should be on or off.", value))
+}
+
+// parseChannel accepts a channel mention or ID and checks that it belongs to
+// the guild and is of the expected type. "none" clears the value.
+func parseChannel(dg *discordgo.Session, guild, value string, kind discordgo.ChannelType) (string, error) {
+	if value == "none" || value == "" {
+		return "", nil
+	}
+
+	match := channelMentionRegex.FindStringSubmatch(value)
+	if match == nil {
+		return "", commandError(fmt.Sprintf("%q isn't a channel.", value))
+	}
+	id := match[1] + match[2]
+
+	ch, err := dg.Channel(id)
+	if err != nil || ch.GuildID != guild {
+		return "", commandError(fmt.Sprintf("I can't find %s in this server.", value))
+	}
+	if ch.Type != kind {
+		return "", commandError(fmt.Sprintf("%s is the wrong kind of channel.", value))
+	}
+	return id, nil
+}
+
+func showRole(id string) string {
+	if id == "" {
+		return "none"
+	}
+	return "<@&" + id + ">"
+}
+
+// parseRole accepts a role mention, ID or name from the guild. "none" clears
+// the value.
+func parseRole(dg *discordgo.Session, guild, value string) (string, error) {
+	if value == "none" || value == "" {
+		return "", nil
+	}
+
+	roles, err := dg.GuildRoles(guild)
+	if err != nil {
+		return "", err
+	}
+	id := value
+	if match := roleMentionRegex.FindStringSubmatch(value); match != nil {
+		id = match[1] + match[2]
+	}
+	for _, role := range roles {
+		if role.ID == id || strings.EqualFold(role.Name, value) {
+			return role.ID, nil
+		}
+	}
+	return "", commandError(fmt.Sprintf("I can't find a role called %s in this server.", value))
+}
+
+func findSetting(key string) *setting {
+	for _, s := range settingKeys {
+		if s.key == strings.ToLower(key) {
+			return s
+		}
+	}
+	return nil
+}
+
+func configCommand(ctx *commandContext) error {
+	if ctx.guild == "" {
+		return commandError("Settings can only be changed inside a server.")
+	}
+
+	action := strings.ToLower(ctx.str("action"))
+	if action == "" || action == "show" {
+		var fields []*discordgo.MessageEmbedField
+		for _, key := range settingKeys {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:   key.key,
+				Value:  key.show(ctx.settings) + "\n*" + key.description + "*",
+				Inline: true,
+			})
+		}
+		_, err := ctx.replyEmbed(&discordgo.MessageEmbed{
+			Title:  "Server settings",
+			Fields: fields,
+			Footer: &discordgo.MessageEmbedFooter{
+				Text: fmt.Sprintf("Change one with %sconfig set <key> <value>", ctx.prefix),
+			},
+		})
+		return err
+	}
+
+	if action != "set" && action != "reset" {
+		return usageError(fmt.Sprintf("unknown action %q, use set or reset", action))
+	}
+	if !ctx.has("key") {
+		return usageError("missing <key>")
+	}
+
+	key := findSetting(ctx.str("key"))
+	if key == nil {
+		var keys []string
+		for _, k := range settingKeys {
+			keys = append(keys, k.key)
+		}
+		return commandError(fmt.Sprintf("Unknown setting %q. Settings are: %s.", ctx.str("key"), strings.Join(keys, ", ")))
+	}
+
+	value := key.def
+	if action == "set" {
+		if !ctx.has("value") {
+			return usageError("missing <value>")
+		}
+		value = ctx.str("value")
+	}
+
+	updated := *ctx.settings
+	if err := key.set(ctx.dg, &updated, value); err != nil {
+		return err
+	}
+	if err := saveSettings(&updated); err != nil {
+		return err
+	}
+
+	_, err := ctx.reply(fmt.Sprintf("**%s** is now %s.", key.key, key.show(&updated)))
+	return err
+}
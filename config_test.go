@@ -0,0 +1,115 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultSettings(t *testing.T) {
+	s := defaultSettings("1")
+	want := &guildSettings{
+		Guild:           "1",
+		Prefix:          "!",
+		Timezone:        "UTC",
+		PublicDrafts:    true,
+		ChannelTemplate: "draft-{name}",
+		RoleTemplate:    "{name} Drafter",
+		MentionLookups:  true,
+		ReminderMinutes: 30,
+		ArchiveMode:     "archive",
+		CleanupDays:     7,
+		SignupEmoji:     "✅",
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("defaultSettings = %+v, want %+v", s, want)
+	}
+	if got := s.channelName("Week 1 Draft"); got != "draft-week 1 draft" {
+		t.Errorf("channelName = %q, want %q", got, "draft-week 1 draft")
+	}
+	if got := s.roleName("Week 1"); got != "Week 1 Drafter" {
+		t.Errorf("roleName = %q, want %q", got, "Week 1 Drafter")
+	}
+}
+
+func TestSetSetting(t *testing.T) {
+	// Settings that don't look anything up in Discord.
+	tests := []struct {
+		key, value string
+		ok         bool
+	}{
+		{"prefix", "?", true},
+		{"prefix", "", false},
+		{"prefix", "toolong", false},
+		{"prefix", "a b", false},
+		{"timezone", "UTC", true},
+		{"timezone", "Mars/Olympus_Mons", false},
+		{"public-drafts", "off", true},
+		{"public-drafts", "maybe", false},
+		{"archive-mode", "DELETE", true},
+		{"archive-mode", "shred", false},
+		{"cleanup-days", "0", true},
+		{"cleanup-days", "366", false},
+		{"cleanup-days", "-1", false},
+		{"max-drafters", "250", true},
+		{"max-drafters", "251", false},
+		{"channel-name", "{name}-picks", true},
+		{"channel-name", "picks", false},
+		{"role-name", "{name}", true},
+		{"role-name", "Drafter", false},
+		{"reminder", "10080", true},
+		{"reminder", "10081", false},
+		{"reminder", "soon", false},
+		{"signup-emoji", "👍", true},
+		{"signup-emoji", "👍 👎", false},
+		{"channels", "all", true},
+		{"notify-channel", "none", true},
+		{"scout-role", "none", true},
+	}
+	for _, test := range tests {
+		setting := findSetting(test.key)
+		if setting == nil {
+			t.Fatalf("findSetting(%q) = nil", test.key)
+		}
+		err := setting.set(nil, defaultSettings("1"), test.value)
+		if test.ok && err != nil {
+			t.Errorf("setting %s to %q failed: %v", test.key, test.value, err)
+		}
+		if !test.ok {
+			if _, isCommand := err.(commandError); !isCommand {
+				t.Errorf("setting %s to %q error = %#v, want a commandError", test.key, test.value, err)
+			}
+		}
+	}
+
+	s := defaultSettings("1")
+	findSetting("ARCHIVE-MODE").set(nil, s, "Delete")
+	findSetting("signup-emoji").set(nil, s, "<:party:1234>")
+	if s.ArchiveMode != "delete" || s.SignupEmoji != "party:1234" {
+		t.Errorf("ArchiveMode, SignupEmoji = %q, %q, want delete, party:1234", s.ArchiveMode, s.SignupEmoji)
+	}
+	if findSetting("color") != nil {
+		t.Error("findSetting found an unknown key")
+	}
+}
+
+func TestParseBool(t *testing.T) {
+	for value, want := range map[string]bool{"on": true, "YES": true, "Enabled": true, "off": false, "false": false, "disabled": false} {
+		if got, err := parseBool(value); err != nil || got != want {
+			t.Errorf("parseBool(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseBool("sometimes"); err == nil {
+		t.Error("parseBool(sometimes) didn't fail")
+	}
+}
+
+func TestChannelAllowed(t *testing.T) {
+	s := defaultSettings("1")
+	if !s.channelAllowed("5") {
+		t.Error("every channel should be allowed without a list")
+	}
+	s.AllowedChannels = []string{"5", "6"}
+	if !s.channelAllowed("6") || s.channelAllowed("7") {
+		t.Errorf("channelAllowed with %v is wrong", s.AllowedChannels)
+	}
+}
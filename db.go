@@ -0,0 +1,231 @@
+package main
+
+import (
+	"log"
+)
+
+// schema is run in order at startup. Every statement must be safe to run
+// against a database that is already up to date.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS Drafts (
+		Draft_Key SERIAL PRIMARY KEY,
+		Name      TEXT NOT NULL,
+		Teams     TEXT NOT NULL,
+		Rounds    INTEGER NOT NULL,
+		Date      TIMESTAMP NOT NULL,
+		Guild     TEXT NOT NULL,
+		Orig_ch   TEXT NOT NULL,
+		Msg       TEXT NOT NULL,
+		Channel   TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS Guild_Settings (
+		Guild            TEXT PRIMARY KEY,
+		Prefix           TEXT NOT NULL,
+		Timezone         TEXT NOT NULL,
+		Draft_Category   TEXT NOT NULL DEFAULT '',
+		Channel_Template TEXT NOT NULL,
+		Role_Template    TEXT NOT NULL,
+		Mention_Lookups  BOOLEAN NOT NULL DEFAULT TRUE,
+		Allowed_Channels TEXT NOT NULL DEFAULT '',
+		Notify_Channel   TEXT NOT NULL DEFAULT '',
+		Reminder_Minutes INTEGER NOT NULL DEFAULT 30
+	)`,
+	`ALTER TABLE Guild_Settings ADD COLUMN IF NOT EXISTS Public_Drafts BOOLEAN NOT NULL DEFAULT TRUE`,
+	`ALTER TABLE Guild_Settings ADD COLUMN IF NOT EXISTS Archive_Category TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE Guild_Settings ADD COLUMN IF NOT EXISTS Archive_Mode TEXT NOT NULL DEFAULT 'archive'`,
+	`ALTER TABLE Guild_Settings ADD COLUMN IF NOT EXISTS Cleanup_Days INTEGER NOT NULL DEFAULT 7`,
+	`ALTER TABLE Drafts ADD COLUMN IF NOT EXISTS Role TEXT`,
+	`ALTER TABLE Drafts ADD COLUMN IF NOT EXISTS Status TEXT NOT NULL DEFAULT 'proposed'`,
+	`ALTER TABLE Drafts ADD COLUMN IF NOT EXISTS Completed_At TIMESTAMP`,
+	`UPDATE Drafts SET Status = 'active' WHERE Status = 'proposed' AND COALESCE(Channel, '') <> ''`,
+	`ALTER TABLE Guild_Settings ADD COLUMN IF NOT EXISTS Signup_Emoji TEXT NOT NULL DEFAULT '✅'`,
+	`ALTER TABLE Guild_Settings ADD COLUMN IF NOT EXISTS Max_Drafters INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE Drafts ADD COLUMN IF NOT EXISTS Roster_Msg TEXT`,
+	`CREATE INDEX IF NOT EXISTS Drafts_Msg ON Drafts (Msg)`,
+	`CREATE TABLE IF NOT EXISTS Draft_Signups (
+		Draft_Key INTEGER NOT NULL REFERENCES Drafts (Draft_Key) ON DELETE CASCADE,
+		Member    TEXT NOT NULL,
+		Joined_At TIMESTAMP NOT NULL,
+		PRIMARY KEY (Draft_Key, Member)
+	)`,
+	`CREATE TABLE IF NOT EXISTS Follows (
+		Channel    TEXT NOT NULL,
+		Guild      TEXT NOT NULL,
+		Kind       TEXT NOT NULL,
+		Target     TEXT NOT NULL,
+		Created_At TIMESTAMP NOT NULL,
+		PRIMARY KEY (Channel, Kind, Target)
+	)`,
+	`CREATE TABLE IF NOT EXISTS Elo_Ratings (
+		Team       TEXT PRIMARY KEY,
+		Rating     DOUBLE PRECISION NOT NULL,
+		Updated_At TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS Elo_History (
+		Team      TEXT NOT NULL,
+		Match_Key TEXT NOT NULL,
+		Year      INTEGER NOT NULL,
+		Played_At TIMESTAMP NOT NULL,
+		Rating    DOUBLE PRECISION NOT NULL,
+		PRIMARY KEY (Team, Match_Key)
+	)`,
+	`CREATE INDEX IF NOT EXISTS Elo_History_Team_Year ON Elo_History (Team, Year, Played_At)`,
+	`CREATE TABLE IF NOT EXISTS Elo_Matches (
+		Match_Key TEXT PRIMARY KEY,
+		Event     TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS Elo_Matches_Event ON Elo_Matches (Event)`,
+	`CREATE TABLE IF NOT EXISTS Elo_Events (
+		Event    TEXT PRIMARY KEY,
+		Year     INTEGER NOT NULL,
+		Complete BOOLEAN NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS Elo_Seasons (
+		Year INTEGER PRIMARY KEY
+	)`,
+	`CREATE TABLE IF NOT EXISTS Pickem_Matches (
+		Channel   TEXT NOT NULL,
+		Match_Key TEXT NOT NULL,
+		Guild     TEXT NOT NULL,
+		Event     TEXT NOT NULL,
+		Msg       TEXT NOT NULL,
+		Start_At  TIMESTAMP NOT NULL,
+		Locked    BOOLEAN NOT NULL DEFAULT FALSE,
+		Result    TEXT,
+		PRIMARY KEY (Channel, Match_Key)
+	)`,
+	`CREATE INDEX IF NOT EXISTS Pickem_Matches_Msg ON Pickem_Matches (Msg)`,
+	`CREATE INDEX IF NOT EXISTS Pickem_Matches_Guild ON Pickem_Matches (Guild, Start_At)`,
+	`CREATE TABLE IF NOT EXISTS Pickem_Picks (
+		Channel   TEXT NOT NULL,
+		Match_Key TEXT NOT NULL,
+		Member    TEXT NOT NULL,
+		Pick      TEXT NOT NULL,
+		Picked_At TIMESTAMP NOT NULL,
+		Correct   BOOLEAN,
+		PRIMARY KEY (Channel, Match_Key, Member),
+		FOREIGN KEY (Channel, Match_Key) REFERENCES Pickem_Matches (Channel, Match_Key) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS Cmp_Slots (
+		District TEXT PRIMARY KEY,
+		Slots    INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS Team_Matches (
+		Team         TEXT NOT NULL,
+		Year         INTEGER NOT NULL,
+		Match_Key    TEXT NOT NULL,
+		Event        TEXT NOT NULL,
+		Comp_Level   TEXT NOT NULL,
+		Set_Number   INTEGER NOT NULL,
+		Match_Number INTEGER NOT NULL,
+		Red          TEXT NOT NULL,
+		Blue         TEXT NOT NULL,
+		Red_Score    INTEGER NOT NULL,
+		Blue_Score   INTEGER NOT NULL,
+		Winner       TEXT NOT NULL,
+		Played_At    BIGINT NOT NULL,
+		PRIMARY KEY (Team, Match_Key)
+	)`,
+	`CREATE INDEX IF NOT EXISTS Team_Matches_Year ON Team_Matches (Team, Year)`,
+	`CREATE TABLE IF NOT EXISTS Team_Match_Years (
+		Team       TEXT NOT NULL,
+		Year       INTEGER NOT NULL,
+		Fetched_At TIMESTAMP NOT NULL,
+		PRIMARY KEY (Team, Year)
+	)`,
+	`CREATE TABLE IF NOT EXISTS Awards (
+		Year       INTEGER NOT NULL,
+		Event      TEXT NOT NULL,
+		District   TEXT NOT NULL,
+		Award_Type INTEGER NOT NULL,
+		Name       TEXT NOT NULL,
+		Team       TEXT NOT NULL,
+		Awardee    TEXT NOT NULL,
+		PRIMARY KEY (Event, Award_Type, Team, Awardee)
+	)`,
+	`CREATE INDEX IF NOT EXISTS Awards_Year_Type ON Awards (Year, Award_Type)`,
+	`CREATE INDEX IF NOT EXISTS Awards_Year_District ON Awards (Year, District)`,
+	`CREATE INDEX IF NOT EXISTS Awards_Team ON Awards (Team, Year)`,
+	`CREATE TABLE IF NOT EXISTS Award_Years (
+		Year       INTEGER PRIMARY KEY,
+		Indexed_At TIMESTAMP NOT NULL
+	)`,
+	`ALTER TABLE Drafts ADD COLUMN IF NOT EXISTS Reminded BOOLEAN NOT NULL DEFAULT FALSE`,
+	`CREATE TABLE IF NOT EXISTS Draft_Reminder_Optins (
+		Guild  TEXT NOT NULL,
+		Member TEXT NOT NULL,
+		PRIMARY KEY (Guild, Member)
+	)`,
+	`CREATE TABLE IF NOT EXISTS Event_Announcements (
+		Channel      TEXT NOT NULL,
+		Event        TEXT NOT NULL,
+		Phase        TEXT NOT NULL,
+		Announced_At TIMESTAMP NOT NULL,
+		PRIMARY KEY (Channel, Event, Phase)
+	)`,
+	`CREATE TABLE IF NOT EXISTS Bracket_Pins (
+		Channel TEXT NOT NULL,
+		Event   TEXT NOT NULL,
+		Message TEXT NOT NULL,
+		Summary TEXT NOT NULL,
+		PRIMARY KEY (Channel, Event)
+	)`,
+	`ALTER TABLE Guild_Settings ADD COLUMN IF NOT EXISTS Scout_Role TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS Allsel_Boards (
+		Channel    TEXT NOT NULL,
+		Event      TEXT NOT NULL,
+		Guild      TEXT NOT NULL,
+		Metric     TEXT NOT NULL,
+		Message    TEXT NOT NULL,
+		Summary    TEXT NOT NULL,
+		Created_At TIMESTAMP NOT NULL,
+		PRIMARY KEY (Channel, Event)
+	)`,
+	`CREATE TABLE IF NOT EXISTS Allsel_Dnp (
+		Guild    TEXT NOT NULL,
+		Event    TEXT NOT NULL,
+		Team     TEXT NOT NULL,
+		Reason   TEXT NOT NULL,
+		Added_By TEXT NOT NULL,
+		PRIMARY KEY (Guild, Event, Team)
+	)`,
+	`CREATE TABLE IF NOT EXISTS Scouting_Scores (
+		Guild TEXT NOT NULL,
+		Event TEXT NOT NULL,
+		Team  TEXT NOT NULL,
+		Score DOUBLE PRECISION NOT NULL,
+		PRIMARY KEY (Guild, Event, Team)
+	)`,
+	// Draft dates used to be stored as the guild's wall clock time. Convert
+	// those rows to UTC once; Date_Utc defaults to TRUE afterwards so new
+	// rows are never converted.
+	`ALTER TABLE Drafts ADD COLUMN IF NOT EXISTS Date_Utc BOOLEAN NOT NULL DEFAULT FALSE`,
+	`UPDATE Drafts SET Date = (Date AT TIME ZONE COALESCE((SELECT Timezone FROM Guild_Settings g WHERE g.Guild = Drafts.Guild), 'UTC')) AT TIME ZONE 'UTC', Date_Utc = TRUE
+		WHERE NOT Date_Utc`,
+	`ALTER TABLE Drafts ALTER COLUMN Date_Utc SET DEFAULT TRUE`,
+	`CREATE TABLE IF NOT EXISTS Draft_Reminders_Sent (
+		Draft_Key INTEGER NOT NULL REFERENCES Drafts (Draft_Key) ON DELETE CASCADE,
+		Member    TEXT NOT NULL,
+		PRIMARY KEY (Draft_Key, Member)
+	)`,
+	// Slots used to be shared by every guild, so any admin could change them
+	// for everyone. Key them by guild and drop the shared rows; the shipped
+	// defaults in cmp.go cover districts a guild hasn't set.
+	`ALTER TABLE Cmp_Slots ADD COLUMN IF NOT EXISTS Guild TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE Cmp_Slots DROP CONSTRAINT IF EXISTS Cmp_Slots_pkey`,
+	`DELETE FROM Cmp_Slots WHERE Guild = ''`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS Cmp_Slots_Guild ON Cmp_Slots (Guild, District)`,
+	`CREATE TABLE IF NOT EXISTS Feed_Tokens (
+		Guild TEXT PRIMARY KEY,
+		Token TEXT NOT NULL UNIQUE
+	)`,
+	`ALTER TABLE Team_Matches ADD COLUMN IF NOT EXISTS Event_Start TEXT NOT NULL DEFAULT ''`,
+}
+
+func migrate() {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
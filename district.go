@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	districtRowsPerPage = 20
+
+	// qualAlpha is the α in the official qualification points formula.
+	qualAlpha = 1.07
+
+	// Event types whose points count triple.
+	eventDistrictCmp         = 2
+	eventDistrictCmpDivision = 5
+)
+
+// individualAwards go to people rather than teams and are worth no district
+// points.
+var individualAwards = map[int]bool{
+	awardWoodieFlowers: true,
+	awardDeansList:     true,
+	awardVolunteer:     true,
+	awardFounders:      true,
+	awardBartKamen:     true,
+	awardMakeItLoud:    true,
+}
+
+// districtKey expands a district abbreviation such as fim into this season's
+// district key, leaving full keys such as 2019fim alone.
+func districtKey(raw string) string {
+	key := strings.ToLower(raw)
+	if !eventKeyRegex.MatchString(key) {
+		key = fmt.Sprintf("%d%s", time.Now().Year(), key)
+	}
+	return key
+}
+
+// districtPoints is a team's points from a single event.
+type districtPoints struct {
+	Qual     int
+	Alliance int
+	Elim     int
+	Award    int
+}
+
+func (p *districtPoints) total() int {
+	return p.Qual + p.Alliance + p.Elim + p.Award
+}
+
+// qualPoints is the official qualification points formula for a team
+// ranked rank of teams.
+func qualPoints(rank, teams int) int {
+	n := float64(teams)
+	x := math.Erfinv((n-2*float64(rank)+2)/(qualAlpha*n)) * (10 / math.Erfinv(1/qualAlpha))
+	return int(math.Ceil(x + 12))
+}
+
+// selectionPoints are awarded by alliance number. Captains and first picks
+// get 17 minus the alliance number, second picks get the alliance number.
+func selectionPoints(alliance, pick int) int {
+	switch pick {
+	case 0, 1:
+		return 17 - alliance
+	case 2:
+		return alliance
+	}
+	return 0
+}
+
+// doubleElimPoints are the playoff points an alliance has secured in the
+// double elimination bracket used since 2023.
+func doubleElimPoints(a *tbaAlliance) int {
+	if a.Status == nil {
+		return 0
+	}
+	switch {
+	case a.Status.Status == "won":
+		return 30
+	case a.Status.Level == "f" || a.Status.DoubleElimRound == "Finals":
+		return 20
+	case a.Status.DoubleElimRound == "Round 5":
+		return 13
+	case a.Status.DoubleElimRound == "Round 4":
+		return 7
+	}
+	return 0
+}
+
+func awardPoints(awardType int) int {
+	switch {
+	case awardType == awardChairmans:
+		return 10
+	case awardType == awardEngineeringInspiration, awardType == awardRookieAllStar:
+		return 8
+	case awardType == awardWinner, awardType == awardFinalist, individualAwards[awardType]:
+		return 0
+	}
+	return 5
+}
+
+// eventDistrictPoints works out every team's district points from an
+// event's rankings, alliances, playoff results and awards so far. Age points
+// are per season, not per event, so they aren't included.
+func eventDistrictPoints(e *tbaEvent) (map[string]*districtPoints, error) {
+	points := map[string]*districtPoints{}
+	team := func(key string) *districtPoints {
+		if points[key] == nil {
+			points[key] = &districtPoints{}
+		}
+		return points[key]
+	}
+
+	rankings, err := tbaEventRankings(e.Key)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	for _, r := range rankings.Rankings {
+		team(r.TeamKey).Qual = qualPoints(r.Rank, len(rankings.Rankings))
+	}
+
+	alliances, err := tbaEventAlliances(e.Key)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	for i := range alliances {
+		for pick, key := range alliances[i].Picks {
+			team(key).Alliance += selectionPoints(i+1, pick)
+		}
+	}
+
+	if e.Year >= 2023 {
+		for i := range alliances {
+			for pick, key := range alliances[i].Picks {
+				if pick < 3 {
+					team(key).Elim += doubleElimPoints(&alliances[i])
+				}
+			}
+		}
+	} else {
+		// Before 2023 every playoff match won was worth 5 points to each team
+		// that played in it.
+		matches, err := tbaEventMatches(e.Key)
+		if err = ignoreNotFound(err); err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if m.CompLevel == "qm" || !m.played() || m.WinningAlliance == "" {
+				continue
+			}
+			for _, key := range m.Alliances[m.WinningAlliance].TeamKeys {
+				team(key).Elim += 5
+			}
+		}
+	}
+
+	awards, err := tbaEventAwards(e.Key)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+	for _, award := range awards {
+		for _, recipient := range award.RecipientList {
+			if recipient.TeamKey != "" {
+				team(recipient.TeamKey).Award += awardPoints(award.AwardType)
+			}
+		}
+	}
+
+	if e.EventType == eventDistrictCmp || e.EventType == eventDistrictCmpDivision {
+		for _, p := range points {
+			p.Qual *= 3
+			p.Alliance *= 3
+			p.Elim *= 3
+			p.Award *= 3
+		}
+	}
+	return points, nil
+}
+
+// tablePages splits table rows into paginated code block embeds.
+func tablePages(title, url, header string, rows []string, perPage int, footer string) []*discordgo.MessageEmbed {
+	var pages []*discordgo.MessageEmbed
+	for start := 0; start < len(rows); start += perPage {
+		end := start + perPage
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "```\n%s\n%s\n```", header, strings.Join(rows[start:end], "\n"))
+		page := &discordgo.MessageEmbed{
+			Title:       title,
+			URL:         url,
+			Color:       tbaColor,
+			Description: buf.String(),
+		}
+		if footer != "" {
+			page.Footer = &discordgo.MessageEmbedFooter{Text: footer}
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+func districtCommand(ctx *commandContext) error {
+	key := districtKey(ctx.str("district"))
+
+	rankings, err := tbaDistrictRankings(key)
+	if err == errTBANotFound || (err == nil && len(rankings) == 0) {
+		return commandError(fmt.Sprintf("TBA doesn't have rankings for the %s district.", key))
+	}
+	if err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("%4s %-6s %4s %4s %4s %4s %3s %5s", "#", "Team", "Qual", "Sel", "Elim", "Awd", "Age", "Total")
+	var rows []string
+	for _, r := range rankings {
+		var sum districtPoints
+		for _, ep := range r.EventPoints {
+			sum.Qual += ep.QualPoints
+			sum.Alliance += ep.AlliancePoints
+			sum.Elim += ep.ElimPoints
+			sum.Award += ep.AwardPoints
+		}
+		rows = append(rows, fmt.Sprintf("%4d %-6s %4d %4d %4d %4d %3d %5d", r.Rank, strings.TrimPrefix(r.TeamKey, "frc"),
+			sum.Qual, sum.Alliance, sum.Elim, sum.Award, r.RookieBonus, r.PointTotal))
+	}
+
+	pages := tablePages(key+" district rankings", "https://www.thebluealliance.com/events/"+key[4:]+"/"+key[:4]+"#rankings",
+		header, rows, districtRowsPerPage, "Qualifications, alliance selection, playoffs, awards and rookie/age points")
+	_, err = ctx.replyPages(pages)
+	return err
+}
+
+func districtPointsCommand(ctx *commandContext) error {
+	event := ctx.str("event")
+	e, err := tbaEventInfo(event)
+	if err == errTBANotFound {
+		return commandError(fmt.Sprintf("TBA doesn't know about %s.", event))
+	}
+	if err != nil {
+		return err
+	}
+
+	points, err := eventDistrictPoints(e)
+	if err != nil {
+		return err
+	}
+	if len(points) == 0 {
+		return commandError(fmt.Sprintf("%s doesn't have any results to calculate points from yet.", event))
+	}
+
+	title := fmt.Sprintf("%d %s district points", e.Year, e.Name)
+	url := "https://www.thebluealliance.com/event/" + event
+	footer := "Calculated from TBA results so far"
+	if e.EventType == eventDistrictCmp || e.EventType == eventDistrictCmpDivision {
+		footer += " • district championship points count triple"
+	}
+	if e.District == nil {
+		footer += " • this isn't a district event, so these are hypothetical"
+	}
+
+	if ctx.has("team") {
+		key := teamKey(ctx.str("team"))
+		p := points[key]
+		if p == nil {
+			return commandError(fmt.Sprintf("Team %s doesn't have any points at %s yet.", ctx.str("team"), event))
+		}
+
+		_, err = ctx.replyEmbed(&discordgo.MessageEmbed{
+			Title: fmt.Sprintf("Team %s at %s", ctx.str("team"), e.Name),
+			URL:   url,
+			Color: tbaColor,
+			Fields: []*discordgo.MessageEmbedField{
+				{Name: "Qualifications", Value: fmt.Sprintf("%d", p.Qual), Inline: true},
+				{Name: "Alliance selection", Value: fmt.Sprintf("%d", p.Alliance), Inline: true},
+				{Name: "Playoffs", Value: fmt.Sprintf("%d", p.Elim), Inline: true},
+				{Name: "Awards", Value: fmt.Sprintf("%d", p.Award), Inline: true},
+				{Name: "Total", Value: fmt.Sprintf("**%d**", p.total()), Inline: true},
+			},
+			Footer: &discordgo.MessageEmbedFooter{Text: footer},
+		})
+		return err
+	}
+
+	var teams []string
+	for key := range points {
+		teams = append(teams, key)
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		if points[teams[i]].total() != points[teams[j]].total() {
+			return points[teams[i]].total() > points[teams[j]].total()
+		}
+		return points[teams[i]].Qual > points[teams[j]].Qual
+	})
+
+	header := fmt.Sprintf("%4s %-6s %4s %4s %4s %4s %5s", "#", "Team", "Qual", "Sel", "Elim", "Awd", "Total")
+	var rows []string
+	for i, key := range teams {
+		p := points[key]
+		rows = append(rows, fmt.Sprintf("%4d %-6s %4d %4d %4d %4d %5d", i+1, strings.TrimPrefix(key, "frc"),
+			p.Qual, p.Alliance, p.Elim, p.Award, p.total()))
+	}
+
+	_, err = ctx.replyPages(tablePages(title, url, header, rows, districtRowsPerPage, footer))
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "district",
+		aliases: []string{"d"},
+		summary: "Show a district's rankings with a points breakdown.",
+		help:    "Use an abbreviation like fim for this season, or a full key like 2019fim.",
+		args:    []argSpec{{name: "district"}},
+		run:     districtCommand,
+	})
+
+	registerCommand(&command{
+		name:    "dpoints",
+		aliases: []string{"districtpoints"},
+		summary: "Calculate district points from an event's results so far.",
+		help:    "Uses the official formula, so points can be projected mid-event before TBA updates. Give a team for its breakdown.",
+		args: []argSpec{
+			{name: "event", kind: argEvent},
+			{name: "team", kind: argTeam, optional: true},
+		},
+		run: districtPointsCommand,
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQualPoints(t *testing.T) {
+	// Rank 1 always earns 22 and the last team of a 40 team event earns 4.
+	tests := []struct {
+		rank, teams, want int
+	}{
+		{1, 40, 22},
+		{20, 40, 13},
+		{40, 40, 4},
+		{1, 12, 22},
+		{12, 12, 6},
+		{1, 64, 22},
+		{64, 64, 3},
+	}
+	for _, test := range tests {
+		if got := qualPoints(test.rank, test.teams); got != test.want {
+			t.Errorf("qualPoints(%d, %d) = %d, want %d", test.rank, test.teams, got, test.want)
+		}
+	}
+}
+
+func TestSelectionPoints(t *testing.T) {
+	tests := []struct {
+		alliance, pick, want int
+	}{
+		{1, 0, 16},
+		{1, 1, 16},
+		{1, 2, 1},
+		{8, 0, 9},
+		{8, 2, 8},
+		// Backup robots earn nothing.
+		{3, 3, 0},
+	}
+	for _, test := range tests {
+		if got := selectionPoints(test.alliance, test.pick); got != test.want {
+			t.Errorf("selectionPoints(%d, %d) = %d, want %d", test.alliance, test.pick, got, test.want)
+		}
+	}
+}
+
+func TestDoubleElimPoints(t *testing.T) {
+	tests := []struct {
+		status string
+		want   int
+	}{
+		{`null`, 0},
+		{`{"status": "won", "level": "f"}`, 30},
+		{`{"status": "eliminated", "level": "f"}`, 20},
+		{`{"status": "playing", "double_elim_round": "Finals"}`, 20},
+		{`{"status": "eliminated", "double_elim_round": "Round 5"}`, 13},
+		{`{"status": "eliminated", "double_elim_round": "Round 4"}`, 7},
+		{`{"status": "eliminated", "double_elim_round": "Round 2"}`, 0},
+	}
+	for _, test := range tests {
+		var a tbaAlliance
+		if err := json.Unmarshal([]byte(`{"status": `+test.status+`}`), &a); err != nil {
+			t.Fatal(err)
+		}
+		if got := doubleElimPoints(&a); got != test.want {
+			t.Errorf("doubleElimPoints(%s) = %d, want %d", test.status, got, test.want)
+		}
+	}
+}
+
+func TestAwardPoints(t *testing.T) {
+	tests := []struct {
+		award, want int
+	}{
+		{awardChairmans, 10},
+		{awardEngineeringInspiration, 8},
+		{awardRookieAllStar, 8},
+		{awardWinner, 0},
+		{awardFinalist, 0},
+		{awardWoodieFlowers, 0},
+		{awardDeansList, 0},
+		{awardMakeItLoud, 0},
+	}
+	for _, test := range tests {
+		if got := awardPoints(test.award); got != test.want {
+			t.Errorf("awardPoints(%d) = %d, want %d", test.award, got, test.want)
+		}
+	}
+}
+
+func TestDistrictKey(t *testing.T) {
+	if got := districtKey("2019FIM"); got != "2019fim" {
+		t.Errorf("districtKey(2019FIM) = %q, want 2019fim", got)
+	}
+	if got, want := districtKey("ne"), fmt.Sprintf("%dne", time.Now().Year()); got != want {
+		t.Errorf("districtKey(ne) = %q, want %q", got, want)
+	}
+}
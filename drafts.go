@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Values of Drafts.Status.
+const (
+	draftProposed = "proposed"
+	draftActive   = "active"
+	draftArchived = "archived"
+	draftDeleted  = "deleted"
+)
+
+const (
+	// drafterPermissions is granted to the Drafter role in its draft channel.
+	drafterPermissions = discordgo.PermissionReadMessages |
+		discordgo.PermissionSendMessages |
+		discordgo.PermissionReadMessageHistory |
+		discordgo.PermissionAddReactions |
+		discordgo.PermissionEmbedLinks |
+		discordgo.PermissionAttachFiles
+
+	// botPermissions is granted to the bot itself so it can run the draft even
+	// when the channel is hidden from everyone else.
+	botPermissions = drafterPermissions |
+		discordgo.PermissionManageMessages |
+		discordgo.PermissionManageChannels |
+		discordgo.PermissionMentionEveryone
+)
+
+// draftChannelCreate is the body of a guild channel create request. The
+// vendored discordgo only sends a name and type.
+type draftChannelCreate struct {
+	Name                 string                           `json:"name"`
+	Type                 discordgo.ChannelType            `json:"type"`
+	ParentID             string                           `json:"parent_id,omitempty"`
+	Topic                string                           `json:"topic,omitempty"`
+	PermissionOverwrites []*discordgo.PermissionOverwrite `json:"permission_overwrites"`
+}
+
+// draftChannelEdit is the body of a channel modify request used to move a
+// finished draft into the archive category.
+type draftChannelEdit struct {
+	ParentID             string                           `json:"parent_id,omitempty"`
+	PermissionOverwrites []*discordgo.PermissionOverwrite `json:"permission_overwrites"`
+}
+
+// draft is a row of the Drafts table.
+type draft struct {
+	Key     int
+	Name    string
+	Teams   string
+	Rounds  int
+	Date    time.Time
+	Guild   string
+	OrigCh  string
+	Msg     string
+	Channel string
+	Role    string
+	Status  string
+}
+
+var selectDraft = "SELECT Draft_Key, Name, Teams, Rounds, Date, Guild, Orig_ch, Msg, COALESCE(Channel, ''), COALESCE(Role, ''), Status FROM Drafts"
+
+func scanDraft(row interface {
+	Scan(dest ...interface{}) error
+}) (*draft, error) {
+	d := &draft{}
+	err := row.Scan(&d.Key, &d.Name, &d.Teams, &d.Rounds, &d.Date, &d.Guild, &d.OrigCh, &d.Msg, &d.Channel, &d.Role, &d.Status)
+	return d, err
+}
+
+func draftForChannel(channelID string) (*draft, error) {
+	return scanDraft(db.QueryRow(selectDraft+" WHERE Channel = $1", channelID))
+}
+
+// createDraftChannel creates the text channel for a draft under the guild's
+// draft category. Only the Drafter role and the bot can send messages, and
+// everyone else can read along if the guild has public drafts turned on.
+func createDraftChannel(dg *discordgo.Session, settings *guildSettings, name, topic, roleID string) (*discordgo.Channel, error) {
+	everyone := &discordgo.PermissionOverwrite{
+		ID:   settings.Guild, // @everyone shares the guild's ID
+		Type: "role",
+		Deny: discordgo.PermissionSendMessages | discordgo.PermissionAddReactions,
+	}
+	if settings.PublicDrafts {
+		everyone.Allow = discordgo.PermissionReadMessages | discordgo.PermissionReadMessageHistory
+	} else {
+		everyone.Deny |= discordgo.PermissionReadMessages
+	}
+
+	data := draftChannelCreate{
+		Name:     settings.channelName(name),
+		Type:     discordgo.ChannelTypeGuildText,
+		ParentID: settings.DraftCategory,
+		Topic:    topic,
+		PermissionOverwrites: []*discordgo.PermissionOverwrite{
+			everyone,
+			{ID: roleID, Type: "role", Allow: drafterPermissions},
+			{ID: dg.State.User.ID, Type: "member", Allow: botPermissions},
+		},
+	}
+
+	endpoint := discordgo.EndpointGuildChannels(settings.Guild)
+	body, err := dg.RequestWithBucketID("POST", endpoint, data, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var ch *discordgo.Channel
+	err = json.Unmarshal(body, &ch)
+	return ch, err
+}
+
+// createDrafterRole creates the mentionable role used both for channel
+// permissions and for pinging everyone when the draft starts.
+func createDrafterRole(dg *discordgo.Session, settings *guildSettings, name string) (*discordgo.Role, error) {
+	role, err := dg.GuildRoleCreate(settings.Guild)
+	if err != nil {
+		return nil, err
+	}
+
+	return dg.GuildRoleEdit(settings.Guild, role.ID, settings.roleName(name), role.Color, false, role.Permissions, true)
+}
+
+// notifyDraftFailure tells a guild that one of its drafts couldn't be set
+// up, in its notify channel or else where the draft was proposed.
+func notifyDraftFailure(dg *discordgo.Session, settings *guildSettings, origCh, name string, err error) {
+	log.Println(err)
+	channel := settings.NotifyChannel
+	if channel == "" {
+		channel = origCh
+	}
+	msg := fmt.Sprintf("Couldn't set up the **%s** draft, so it was skipped.", name)
+	if _, ok := err.(*discordgo.RESTError); ok {
+		msg += " Check that I can manage roles and channels."
+	}
+	if _, err = dg.ChannelMessageSend(channel, msg); err != nil {
+		log.Println(err)
+	}
+}
+
+func announceDraft(dg *discordgo.Session, channelID, roleID, name string, rounds int) error {
+	_, err := dg.ChannelMessageSend(channelID, fmt.Sprintf(
+		"<@&%s> Welcome to the **%s** draft! %d rounds. Only drafters can post here.", roleID, name, rounds))
+	return err
+}
+
+// cleanupDrafts finishes every active draft that is older than its guild's
+// cleanup period.
+func cleanupDrafts() {
+	dg := session
+	if dg == nil {
+		log.Println("cleanupDrafts: discord is not connected yet")
+		return
+	}
+
+	rows, err := db.Query(selectDraft+" WHERE Status = $1", draftActive)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var expired []*draft
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		days := guildSettingsFor(d.Guild).CleanupDays
+		if days > 0 && time.Since(d.Date) > time.Duration(days)*24*time.Hour {
+			expired = append(expired, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range expired {
+		if err := finishDraft(dg, d); err != nil {
+			log.Println(d.Key, err)
+		}
+	}
+}
+
+// finishDraft posts the pick log to the proposal's channel, archives or
+// deletes the draft channel, removes the Drafter role and records the result.
+func finishDraft(dg *discordgo.Session, d *draft) error {
+	settings := guildSettingsFor(d.Guild)
+
+	// The pick log is the only copy of the picks once the channel is gone,
+	// so a channel whose log couldn't be posted is archived instead.
+	exported := true
+	if d.Channel != "" {
+		if err := postPickLog(dg, d); err != nil {
+			log.Println(d.Key, err)
+			exported = false
+		}
+	}
+
+	status := draftArchived
+	if settings.ArchiveMode == "delete" && exported {
+		status = draftDeleted
+	}
+
+	if d.Channel != "" {
+		var err error
+		if status == draftDeleted {
+			_, err = dg.ChannelDelete(d.Channel)
+		} else {
+			err = archiveDraftChannel(dg, settings, d.Channel)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.Role != "" {
+		if err := dg.GuildRoleDelete(d.Guild, d.Role); err != nil {
+			log.Println(d.Key, err)
+		}
+	}
+
+	_, err := db.Exec("UPDATE Drafts SET Status = $1, Completed_At = $2 WHERE Draft_Key = $3", status, time.Now(), d.Key)
+	return err
+}
+
+// archiveDraftChannel moves a draft channel to the archive category and makes
+// it read-only for everyone but the bot.
+func archiveDraftChannel(dg *discordgo.Session, settings *guildSettings, channelID string) error {
+	data := draftChannelEdit{
+		ParentID: settings.ArchiveCategory,
+		PermissionOverwrites: []*discordgo.PermissionOverwrite{
+			{
+				ID:    settings.Guild,
+				Type:  "role",
+				Allow: discordgo.PermissionReadMessages | discordgo.PermissionReadMessageHistory,
+				Deny:  discordgo.PermissionSendMessages | discordgo.PermissionAddReactions,
+			},
+			{ID: dg.State.User.ID, Type: "member", Allow: botPermissions},
+		},
+	}
+	if !settings.PublicDrafts {
+		data.PermissionOverwrites[0].Allow = 0
+		data.PermissionOverwrites[0].Deny |= discordgo.PermissionReadMessages
+	}
+
+	endpoint := discordgo.EndpointChannel(channelID)
+	_, err := dg.RequestWithBucketID("PATCH", endpoint, data, endpoint)
+	return err
+}
+
+// postPickLog exports every message from the draft channel, oldest first, and
+// posts it as a text file in the channel the draft was proposed in.
+func postPickLog(dg *discordgo.Session, d *draft) error {
+	var messages []*discordgo.Message
+	before := ""
+	for {
+		page, err := dg.ChannelMessages(d.Channel, 100, before, "", "")
+		if err != nil {
+			return err
+		}
+		messages = append(messages, page...)
+		if len(page) < 100 {
+			break
+		}
+		before = page[len(page)-1].ID
+	}
+
+	loc := guildSettingsFor(d.Guild).location()
+	var pickLog bytes.Buffer
+	picks := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		if m.Author == nil || m.Author.Bot || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		picks++
+
+		ts, _ := m.Timestamp.Parse()
+		fmt.Fprintf(&pickLog, "[%s] %s: %s\n", ts.In(loc).Format("01/02 15:04"), m.Author.Username, m.Content)
+	}
+
+	summary := fmt.Sprintf("The **%s** draft is over. %d messages were posted in the draft channel.", d.Name, picks)
+	_, err := dg.ChannelFileSendWithMessage(d.OrigCh, summary, fmt.Sprintf("%s-picks.txt", d.Name), &pickLog)
+	return err
+}
+
+func draftCommand(ctx *commandContext) error {
+	switch strings.ToLower(ctx.str("action")) {
+	case "end", "finish":
+		if !isAdmin(ctx.dg, ctx.msg) {
+			return commandError("Only server admins can end a draft.")
+		}
+
+		d, err := draftForChannel(ctx.msg.ChannelID)
+		if err == sql.ErrNoRows {
+			return commandError("Run this in the draft's channel.")
+		}
+		if err != nil {
+			return err
+		}
+		if d.Status != draftActive {
+			return commandError("This draft is already over.")
+		}
+
+		if _, err = ctx.reply("Wrapping up the draft..."); err != nil {
+			return err
+		}
+		return finishDraft(ctx.dg, d)
+
+	case "remind", "reminders":
+		switch strings.ToLower(ctx.str("value")) {
+		case "on", "yes", "":
+			return setDraftReminders(ctx, true)
+		case "off", "no":
+			return setDraftReminders(ctx, false)
+		}
+		return usageError("use `draft remind on` or `draft remind off`")
+	}
+
+	return usageError(fmt.Sprintf("unknown action %q", ctx.str("action")))
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "draft",
+		summary: "Manage fantasy drafts.",
+		help: "`draft end` in a draft channel posts the pick log, archives the channel and removes the Drafter role. " +
+			"`draft remind on` gets you a DM before drafts you've signed up for, and `draft remind off` stops them.",
+		args: []argSpec{
+			{name: "action"},
+			{name: "value", optional: true},
+		},
+		run: draftCommand,
+	})
+}
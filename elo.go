@@ -0,0 +1,568 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jlmcmchl/tbc-discord-bot/stats"
+)
+
+const (
+	eloTopCount = 25
+	// eloSettleDays is how long after an event ends it is still polled for
+	// late score corrections before being marked complete.
+	eloSettleDays = 2
+	// eloBackfillSeasons is how many seasons before the current one are
+	// replayed when there are no ratings yet, and by default on a rebuild.
+	eloBackfillSeasons = 3
+)
+
+var (
+	eloModel = stats.NewElo()
+	// eloMutex guards eloModel. Syncs build new ratings on a copy and only
+	// hold it to swap the copy in, so readers aren't blocked by TBA calls.
+	eloMutex = &sync.Mutex{}
+	// eloSyncMutex keeps updates and rebuilds from running at the same time.
+	eloSyncMutex = &sync.Mutex{}
+	sparks       = []rune("▁▂▃▄▅▆▇█")
+)
+
+// eloMatch is a played match waiting to be applied to the ratings.
+type eloMatch struct {
+	match  *tbaMatch
+	year   int
+	played time.Time
+}
+
+// loadElo reads the current ratings into memory at startup.
+func loadElo() {
+	eloMutex.Lock()
+	defer eloMutex.Unlock()
+
+	rows, err := db.Query("SELECT Team, Rating FROM Elo_Ratings")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var team string
+		var rating float64
+		if err = rows.Scan(&team, &rating); err != nil {
+			log.Println(err)
+			return
+		}
+		eloModel.Ratings[team] = rating
+	}
+}
+
+// startSeason regresses ratings towards the mean the first time a season is
+// written.
+func startSeason(tx *sql.Tx, model *stats.Elo, year int) error {
+	var seen int
+	err := tx.QueryRow("SELECT COUNT(*) FROM Elo_Seasons WHERE Year = $1", year).Scan(&seen)
+	if err != nil || seen > 0 {
+		return err
+	}
+
+	model.NewSeason()
+	for team, rating := range model.Ratings {
+		if _, err = tx.Exec("UPDATE Elo_Ratings SET Rating = $1 WHERE Team = $2", rating, team); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("INSERT INTO Elo_Seasons (Year) VALUES ($1)", year)
+	return err
+}
+
+// setElo replaces the ratings once a sync's changes are committed.
+func setElo(model *stats.Elo) {
+	eloMutex.Lock()
+	defer eloMutex.Unlock()
+
+	eloModel = model
+}
+
+// eloSeason is what a sync fetched from TBA for one season, ready to be
+// written.
+type eloSeason struct {
+	year     int
+	pending  []eloMatch
+	finished []string
+}
+
+// pendingEloMatches fetches the played matches of an event that aren't in
+// processed yet.
+func pendingEloMatches(e *tbaEvent, processed map[string]bool) ([]eloMatch, bool, error) {
+	matches, err := tbaEventMatches(e.Key)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, false, err
+	}
+
+	start, _ := e.dates()
+	allPlayed := true
+	var pending []eloMatch
+	for i := range matches {
+		m := &matches[i]
+		if !m.played() {
+			allPlayed = false
+			continue
+		}
+		if processed[m.Key] {
+			continue
+		}
+
+		played := start
+		if m.ActualTime != 0 {
+			played = time.Unix(m.ActualTime, 0)
+		} else if m.Time != 0 {
+			played = time.Unix(m.Time, 0)
+		}
+		pending = append(pending, eloMatch{match: m, year: e.Year, played: played})
+	}
+	return pending, allPlayed, nil
+}
+
+// eloKeys reads a column of keys, such as the matches already applied.
+func eloKeys(query string, args ...interface{}) (map[string]bool, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys[key] = true
+	}
+	return keys, rows.Err()
+}
+
+// fetchEloSeason collects every new match of a season's official events.
+// With fresh set it ignores what has already been applied, for rebuilds.
+// Only TBA and reads happen here, so no transaction is held while waiting on
+// TBA.
+func fetchEloSeason(year int, fresh bool) (*eloSeason, error) {
+	events, err := tbaEventsSimple(year)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, err
+	}
+
+	complete := map[string]bool{}
+	if !fresh {
+		if complete, err = eloKeys("SELECT Event FROM Elo_Events WHERE Year = $1 AND Complete", year); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &eloSeason{year: year}
+	for i := range events {
+		e := &events[i]
+		start, end := e.dates()
+		if !e.official() || complete[e.Key] || time.Now().Before(start) {
+			continue
+		}
+
+		processed := map[string]bool{}
+		if !fresh {
+			if processed, err = eloKeys("SELECT Match_Key FROM Elo_Matches WHERE Event = $1", e.Key); err != nil {
+				return nil, err
+			}
+		}
+		matches, allPlayed, err := pendingEloMatches(e, processed)
+		if err != nil {
+			return nil, err
+		}
+		s.pending = append(s.pending, matches...)
+		if allPlayed && time.Since(end) > eloSettleDays*24*time.Hour {
+			s.finished = append(s.finished, e.Key)
+		}
+	}
+	return s, nil
+}
+
+// writeEloSeason applies a fetched season to model in the order matches were
+// played and records every change in tx. Events that ended long enough ago
+// are marked complete and skipped after.
+func writeEloSeason(tx *sql.Tx, model *stats.Elo, s *eloSeason) error {
+	if err := startSeason(tx, model, s.year); err != nil {
+		return err
+	}
+
+	pending := s.pending
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].played.Equal(pending[j].played) {
+			return pending[i].played.Before(pending[j].played)
+		}
+		if pending[i].match.EventKey != pending[j].match.EventKey {
+			return pending[i].match.EventKey < pending[j].match.EventKey
+		}
+		return matchLess(pending[i].match, pending[j].match)
+	})
+
+	for _, p := range pending {
+		m := p.match
+		changes := model.Update(stats.Match{
+			Red:  statsAlliance(m, "red"),
+			Blue: statsAlliance(m, "blue"),
+		}, m.CompLevel != "qm")
+
+		if _, err := tx.Exec("INSERT INTO Elo_Matches (Match_Key, Event) VALUES ($1, $2)", m.Key, m.EventKey); err != nil {
+			return err
+		}
+		for team := range changes {
+			rating := model.Rating(team)
+			_, err := tx.Exec("INSERT INTO Elo_History (Team, Match_Key, Year, Played_At, Rating) VALUES ($1, $2, $3, $4, $5)",
+				team, m.Key, p.year, p.played, rating)
+			if err == nil {
+				_, err = tx.Exec(`INSERT INTO Elo_Ratings (Team, Rating, Updated_At) VALUES ($1, $2, $3)
+					ON CONFLICT (Team) DO UPDATE SET Rating = $2, Updated_At = $3`, team, rating, p.played)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, key := range s.finished {
+		_, err := tx.Exec(`INSERT INTO Elo_Events (Event, Year, Complete) VALUES ($1, $2, TRUE)
+			ON CONFLICT (Event) DO UPDATE SET Complete = TRUE`, key, s.year)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("elo: applied %d matches from %d\n", len(pending), s.year)
+	return nil
+}
+
+// writeElo writes seasons in one transaction, after running prepare in it,
+// and swaps the new ratings in only once everything is committed. Nothing
+// changes if any step fails.
+func writeElo(model *stats.Elo, seasons []*eloSeason, prepare func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if prepare != nil {
+		if err = prepare(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, s := range seasons {
+		if err = writeEloSeason(tx, model, s); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	setElo(model)
+	return nil
+}
+
+// updateElo applies any newly scored matches of the current season. Earlier
+// seasons are only read by a rebuild, so a database without any rated
+// seasons is backfilled from eloBackfillSeasons ago first, which gives the
+// current season ratings carried over from the ones before it.
+func updateElo() {
+	eloSyncMutex.Lock()
+	defer eloSyncMutex.Unlock()
+
+	var seasons int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Elo_Seasons").Scan(&seasons); err != nil {
+		log.Println(err)
+		return
+	}
+	if seasons == 0 {
+		if err := rebuildEloLocked(time.Now().Year() - eloBackfillSeasons); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	s, err := fetchEloSeason(time.Now().Year(), false)
+	if err == nil {
+		err = writeElo(currentElo(), []*eloSeason{s}, nil)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// rebuildElo throws away every rating and replays all seasons since from.
+func rebuildElo(from int) {
+	eloSyncMutex.Lock()
+	defer eloSyncMutex.Unlock()
+
+	if err := rebuildEloLocked(from); err != nil {
+		log.Println(err)
+	}
+}
+
+// rebuildEloLocked fetches every season first and then wipes and replays the
+// ratings in a single transaction, so a failure part way through leaves the
+// old ratings in place.
+func rebuildEloLocked(from int) error {
+	var seasons []*eloSeason
+	for year := from; year <= time.Now().Year(); year++ {
+		s, err := fetchEloSeason(year, true)
+		if err != nil {
+			return err
+		}
+		seasons = append(seasons, s)
+	}
+
+	return writeElo(stats.NewElo(), seasons, func(tx *sql.Tx) error {
+		for _, table := range []string{"Elo_Ratings", "Elo_History", "Elo_Matches", "Elo_Events", "Elo_Seasons"} {
+			if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sparkline draws values as a row of block characters.
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+
+	var line []rune
+	for _, v := range values {
+		i := 0
+		if hi > lo {
+			i = int((v - lo) / (hi - lo) * float64(len(sparks)-1))
+		}
+		line = append(line, sparks[i])
+	}
+	return string(line)
+}
+
+func lastN(values []float64, n int) []float64 {
+	if len(values) > n {
+		return values[len(values)-n:]
+	}
+	return values
+}
+
+// eloHistory returns a team's rating after each match of a season.
+func eloHistory(team string, year int) ([]float64, error) {
+	rows, err := db.Query("SELECT Rating FROM Elo_History WHERE Team = $1 AND Year = $2 ORDER BY Played_At",
+		teamKey(team), year)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ratings []float64
+	for rows.Next() {
+		var rating float64
+		if err = rows.Scan(&rating); err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+	return ratings, rows.Err()
+}
+
+// eloRank returns a team's rating, its position among all rated teams and
+// the number of rated teams. The position is 0 for unrated teams.
+func eloRank(team string) (float64, int, int) {
+	eloMutex.Lock()
+	defer eloMutex.Unlock()
+
+	rating, ok := eloModel.Ratings[teamKey(team)]
+	if !ok {
+		return eloModel.Mean, 0, len(eloModel.Ratings)
+	}
+
+	rank := 1
+	for _, r := range eloModel.Ratings {
+		if r > rating {
+			rank++
+		}
+	}
+	return rating, rank, len(eloModel.Ratings)
+}
+
+func eloTeamCommand(ctx *commandContext, team string) error {
+	rating, rank, rated := eloRank(team)
+	if rank == 0 {
+		return commandError(fmt.Sprintf("Team %s doesn't have a rating yet.", team))
+	}
+
+	year := time.Now().Year()
+	history, err := eloHistory(team, year)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		year--
+		if history, err = eloHistory(team, year); err != nil {
+			return err
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Team %s Elo", team),
+		Color: tbaColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Rating", Value: fmt.Sprintf("%.0f", rating), Inline: true},
+			{Name: "Rank", Value: fmt.Sprintf("#%d of %d", rank, rated), Inline: true},
+		},
+	}
+
+	if len(history) > 0 {
+		peak := history[0]
+		for _, r := range history {
+			if r > peak {
+				peak = r
+			}
+		}
+		change := history[len(history)-1] - history[0]
+		embed.Fields = append(embed.Fields,
+			&discordgo.MessageEmbedField{Name: fmt.Sprintf("%d peak", year), Value: fmt.Sprintf("%.0f", peak), Inline: true},
+			&discordgo.MessageEmbedField{Name: fmt.Sprintf("%d change", year), Value: fmt.Sprintf("%+.0f", change), Inline: true},
+			&discordgo.MessageEmbedField{
+				Name:  fmt.Sprintf("%d, %d matches", year, len(history)),
+				Value: "`" + sparkline(lastN(history, 60)) + "`",
+			},
+		)
+	}
+
+	if _, err = ctx.replyEmbed(embed); err != nil || !ctx.flag("chart") || len(history) == 0 {
+		return err
+	}
+	image, err := eloChart(team, year, history)
+	if err != nil {
+		return err
+	}
+	_, err = ctx.replyChart(fmt.Sprintf("%s-elo-%d.png", team, year), image)
+	return err
+}
+
+func eloTopCommand(ctx *commandContext, district string) error {
+	var filter map[string]bool
+	title := "Top Elo ratings"
+	if district != "" {
+		key := districtKey(district)
+		keys, err := tbaDistrictTeamKeys(key)
+		if err == errTBANotFound || (err == nil && len(keys) == 0) {
+			return commandError(fmt.Sprintf("TBA doesn't know about the %s district.", key))
+		}
+		if err != nil {
+			return err
+		}
+
+		filter = map[string]bool{}
+		for _, k := range keys {
+			filter[k] = true
+		}
+		title += " in " + key
+	}
+
+	eloMutex.Lock()
+	var teams []string
+	ratings := map[string]float64{}
+	for team, rating := range eloModel.Ratings {
+		if filter == nil || filter[team] {
+			teams = append(teams, team)
+			ratings[team] = rating
+		}
+	}
+	eloMutex.Unlock()
+
+	if len(teams) == 0 {
+		return commandError("There aren't any ratings yet.")
+	}
+
+	sort.Slice(teams, func(i, j int) bool { return ratings[teams[i]] > ratings[teams[j]] })
+	if len(teams) > eloTopCount {
+		teams = teams[:eloTopCount]
+	}
+
+	if ctx.flag("chart") {
+		image, err := barChart(title, teams, ratings)
+		if err != nil {
+			return err
+		}
+		_, err = ctx.replyChart("elo-top.png", image)
+		return err
+	}
+
+	lines := []string{fmt.Sprintf("%4s %-6s %6s", "#", "Team", "Elo")}
+	for i, team := range teams {
+		lines = append(lines, fmt.Sprintf("%4d %-6s %6.0f", i+1, strings.TrimPrefix(team, "frc"), ratings[team]))
+	}
+
+	_, err := ctx.replyEmbed(&discordgo.MessageEmbed{
+		Title:       title,
+		Color:       tbaColor,
+		Description: "```\n" + strings.Join(lines, "\n") + "\n```",
+	})
+	return err
+}
+
+func eloCommand(ctx *commandContext) error {
+	arg := strings.ToLower(ctx.str("team"))
+	if arg == "top" {
+		return eloTopCommand(ctx, ctx.str("district"))
+	}
+	if ctx.has("district") {
+		return usageError("only `elo top` takes a district")
+	}
+
+	team, err := convertArg(argSpec{name: "team", kind: argTeam}, arg)
+	if err != nil {
+		return err
+	}
+	return eloTeamCommand(ctx, team.(string))
+}
+
+// eloRating returns a team's current rating for other commands to use.
+func eloRating(teamKey string) float64 {
+	eloMutex.Lock()
+	defer eloMutex.Unlock()
+
+	return eloModel.Rating(teamKey)
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "elo",
+		summary: "Show a team's Elo rating, or the top rated teams.",
+		help: "`elo 254` shows a rating and this season's trend, `elo top [district]` lists the best rated teams. " +
+			"Add --chart to graph either one.",
+		args: []argSpec{
+			{name: "team"},
+			{name: "district", optional: true},
+		},
+		flags: []argSpec{{name: "chart", kind: argBool}},
+		run:   eloCommand,
+	})
+}
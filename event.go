@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	rankingsPerPage = 20
+	tbaDateFmt      = "2006-01-02"
+)
+
+// Event statuses shown by !event.
+const (
+	eventUpcoming = "Upcoming"
+	eventQuals    = "Qualifications"
+	eventPlayoffs = "Playoffs"
+	eventComplete = "Complete"
+)
+
+func eventStatus(e *tbaEvent, matches []tbaMatch, awards []tbaAward) string {
+	for _, award := range awards {
+		if award.AwardType == awardWinner {
+			return eventComplete
+		}
+	}
+
+	played, quals, qualsPlayed, playoffs := 0, 0, 0, 0
+	for i := range matches {
+		m := &matches[i]
+		if m.CompLevel == "qm" {
+			quals++
+		} else {
+			playoffs++
+		}
+		if m.played() {
+			played++
+			if m.CompLevel == "qm" {
+				qualsPlayed++
+			}
+		}
+	}
+
+	switch {
+	case played == 0:
+		return eventUpcoming
+	case playoffs > 0 || (quals > 0 && qualsPlayed == quals):
+		end, _ := time.Parse(tbaDateFmt, e.EndDate)
+		if played == len(matches) && time.Now().After(end.Add(24*time.Hour)) {
+			return eventComplete
+		}
+		return eventPlayoffs
+	}
+	return eventQuals
+}
+
+func eventDates(e *tbaEvent) string {
+	start, err := time.Parse(tbaDateFmt, e.StartDate)
+	if err != nil {
+		return e.StartDate
+	}
+	end, err := time.Parse(tbaDateFmt, e.EndDate)
+	if err != nil || end.Equal(start) {
+		return start.Format("Jan 2, 2006")
+	}
+	if start.Month() == end.Month() {
+		return fmt.Sprintf("%s-%d, %d", start.Format("Jan 2"), end.Day(), end.Year())
+	}
+	return fmt.Sprintf("%s - %s", start.Format("Jan 2"), end.Format("Jan 2, 2006"))
+}
+
+// rankingTable renders rankings as a monospace table inside a code block.
+func rankingTable(r *tbaRankings, rankings []tbaRanking) string {
+	score := "RS"
+	if len(r.SortOrderInfo) > 0 {
+		score = r.SortOrderInfo[0].Name
+	}
+	precision := 2
+	if len(r.SortOrderInfo) > 0 {
+		precision = r.SortOrderInfo[0].Precision
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "```\n%-4s %-6s %-8s %s\n", "Rank", "Team", "W-L-T", score)
+	for _, ranking := range rankings {
+		record := "-"
+		if ranking.Record != nil {
+			record = fmt.Sprintf("%d-%d-%d", ranking.Record.Wins, ranking.Record.Losses, ranking.Record.Ties)
+		}
+		value := ""
+		if len(ranking.SortOrders) > 0 {
+			value = fmt.Sprintf("%.*f", precision, ranking.SortOrders[0])
+		}
+		fmt.Fprintf(&buf, "%4d %-6s %-8s %s\n", ranking.Rank, strings.TrimPrefix(ranking.TeamKey, "frc"), record, value)
+	}
+	buf.WriteString("```")
+	return buf.String()
+}
+
+func teamList(keys []string) string {
+	teams := make([]string, len(keys))
+	for i, key := range keys {
+		teams[i] = strings.TrimPrefix(key, "frc")
+	}
+	return strings.Join(teams, ", ")
+}
+
+func eventCommand(ctx *commandContext) error {
+	key := ctx.str("event")
+	top := 10
+	if ctx.has("top") {
+		top = ctx.num("top")
+	}
+	if top < 1 || top > rankingsPerPage {
+		return commandError(fmt.Sprintf("Show between 1 and %d teams on the first page.", rankingsPerPage))
+	}
+
+	e, err := tbaEventInfo(key)
+	if err == errTBANotFound {
+		return commandError(fmt.Sprintf("TBA doesn't know about %s.", key))
+	}
+	if err != nil {
+		return err
+	}
+
+	rankings, err := tbaEventRankings(key)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	alliances, err := tbaEventAlliances(key)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	awards, err := tbaEventAwards(key)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	matches, err := tbaEventMatches(key)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+
+	title := fmt.Sprintf("%d %s", e.Year, e.Name)
+	url := "https://www.thebluealliance.com/event/" + key
+
+	week := "-"
+	if e.Week != nil {
+		week = fmt.Sprintf("%d", *e.Week+1)
+	}
+
+	summary := &discordgo.MessageEmbed{
+		Title: title,
+		URL:   url,
+		Color: tbaColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Dates", Value: eventDates(e), Inline: true},
+			{Name: "Week", Value: week, Inline: true},
+			{Name: "Status", Value: eventStatus(e, matches, awards), Inline: true},
+			{Name: "Location", Value: orNone(e.location()), Inline: true},
+			{Name: "Type", Value: orNone(e.EventTypeString), Inline: true},
+		},
+	}
+
+	if len(rankings.Rankings) > 0 {
+		n := top
+		if n > len(rankings.Rankings) {
+			n = len(rankings.Rankings)
+		}
+		summary.Fields = append(summary.Fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("Top %d", n),
+			Value: rankingTable(rankings, rankings.Rankings[:n]),
+		})
+	}
+
+	if len(alliances) > 0 {
+		var lines []string
+		for i, alliance := range alliances {
+			name := alliance.Name
+			if name == "" {
+				name = fmt.Sprintf("Alliance %d", i+1)
+			}
+			line := fmt.Sprintf("**%s**: %s", name, teamList(alliance.Picks))
+			if alliance.Status != nil && alliance.Status.Status != "" {
+				line += fmt.Sprintf(" (%s %s)", alliance.Status.Status, alliance.Status.Level)
+			}
+			lines = append(lines, line)
+		}
+		summary.Fields = append(summary.Fields, &discordgo.MessageEmbedField{
+			Name:  "Alliances",
+			Value: truncate(strings.Join(lines, "\n"), 1024),
+		})
+	}
+
+	var winners []string
+	for _, award := range awards {
+		if award.AwardType != awardWinner && award.AwardType != awardChairmans {
+			continue
+		}
+		var teams []string
+		for _, recipient := range award.RecipientList {
+			teams = append(teams, strings.TrimPrefix(recipient.TeamKey, "frc"))
+		}
+		winners = append(winners, fmt.Sprintf("**%s**: %s", award.Name, strings.Join(teams, ", ")))
+	}
+	if len(winners) > 0 {
+		summary.Fields = append(summary.Fields, &discordgo.MessageEmbedField{
+			Name:  "Awards",
+			Value: strings.Join(winners, "\n"),
+		})
+	}
+
+	if ctx.flag("chart") {
+		return eventCharts(ctx, e, summary, matches)
+	}
+
+	pages := []*discordgo.MessageEmbed{summary}
+	for start := 0; start < len(rankings.Rankings); start += rankingsPerPage {
+		end := start + rankingsPerPage
+		if end > len(rankings.Rankings) {
+			end = len(rankings.Rankings)
+		}
+		pages = append(pages, &discordgo.MessageEmbed{
+			Title:       title + " rankings",
+			URL:         url + "#rankings",
+			Color:       tbaColor,
+			Description: rankingTable(rankings, rankings.Rankings[start:end]),
+		})
+	}
+
+	_, err = ctx.replyPages(pages)
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "event",
+		aliases: []string{"e"},
+		summary: "Summarize an event: status, rankings, alliances and winners.",
+		help:    "React with ◀ ▶ to page through the full rankings, or use --chart for estimated rank and score charts instead.",
+		args: []argSpec{
+			{name: "event", kind: argEvent},
+			{name: "top", kind: argInt, optional: true},
+		},
+		flags: []argSpec{{name: "chart", kind: argBool}},
+		run:   eventCommand,
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Kinds of Follows rows.
+const (
+	followEvent  = "event"
+	followPickem = "pickem"
+	followCmp    = "cmp"
+)
+
+// followedEvent returns the event a channel most recently followed, or "".
+func followedEvent(channelID string) (string, error) {
+	var event string
+	err := db.QueryRow("SELECT Target FROM Follows WHERE Channel = $1 AND Kind = $2 ORDER BY Created_At DESC LIMIT 1",
+		channelID, followEvent).Scan(&event)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return event, err
+}
+
+func followCommand(ctx *commandContext) error {
+	if ctx.guild == "" {
+		return commandError("Only server channels can follow events.")
+	}
+
+	event := ctx.str("event")
+	e, err := tbaEventInfo(event)
+	if err == errTBANotFound {
+		return commandError(fmt.Sprintf("TBA doesn't know about %s.", event))
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT INTO Follows (Channel, Guild, Kind, Target, Created_At) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (Channel, Kind, Target) DO UPDATE SET Created_At = $5`,
+		ctx.msg.ChannelID, ctx.guild, followEvent, event, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.reply(fmt.Sprintf("This channel now follows **%d %s**.", e.Year, e.Name))
+	return err
+}
+
+func unfollowCommand(ctx *commandContext) error {
+	res, err := db.Exec("DELETE FROM Follows WHERE Channel = $1 AND Kind = $2 AND Target = $3",
+		ctx.msg.ChannelID, followEvent, ctx.str("event"))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return commandError(fmt.Sprintf("This channel doesn't follow %s.", ctx.str("event")))
+	}
+
+	_, err = ctx.reply(fmt.Sprintf("This channel no longer follows %s.", ctx.str("event")))
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "follow",
+		summary: "Follow an event in this channel.",
+		help:    "Commands like `match qm42` use the event this channel followed most recently.",
+		args:    []argSpec{{name: "event", kind: argEvent}},
+		admin:   true,
+		run:     followCommand,
+	})
+
+	registerCommand(&command{
+		name:    "unfollow",
+		summary: "Stop following an event in this channel.",
+		args:    []argSpec{{name: "event", kind: argEvent}},
+		admin:   true,
+		run:     unfollowCommand,
+	})
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// teamMatchesTTL is how long the current season's cached matches are used
+// before refetching them.
+const teamMatchesTTL = 6 * time.Hour
+
+var yearRangeRegex = regexp.MustCompile(`^(\d{4})(?:-(\d{4}))?$`)
+
+func matchPlayedAt(m *tbaMatch) int64 {
+	if m.ActualTime != 0 {
+		return m.ActualTime
+	}
+	return m.Time
+}
+
+// cacheTeamMatches replaces a team's stored matches for a season. starts
+// holds each event's start date, which orders seasons without match times.
+func cacheTeamMatches(team string, year int, matches []tbaMatch, starts map[string]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Upserting the season first locks its row, so a concurrent lookup of the
+	// same team and season waits here instead of inserting the same matches.
+	_, err = tx.Exec(`INSERT INTO Team_Match_Years (Team, Year, Fetched_At) VALUES ($1, $2, $3)
+		ON CONFLICT (Team, Year) DO UPDATE SET Fetched_At = $3`, team, year, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM Team_Matches WHERE Team = $1 AND Year = $2", team, year); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i := range matches {
+		m := &matches[i]
+		if !m.played() {
+			continue
+		}
+		start := starts[m.EventKey]
+		if start == "" {
+			// Keep matches of an event TBA didn't list at the end of the
+			// season rather than leaving the cache looking stale.
+			start = fmt.Sprintf("%d-12-31", year)
+		}
+		_, err = tx.Exec(`INSERT INTO Team_Matches (Team, Year, Match_Key, Event, Comp_Level, Set_Number, Match_Number,
+			Red, Blue, Red_Score, Blue_Score, Winner, Played_At, Event_Start)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+			team, year, m.Key, m.EventKey, m.CompLevel, m.SetNumber, m.MatchNumber,
+			strings.Join(m.Alliances["red"].TeamKeys, ","), strings.Join(m.Alliances["blue"].TeamKeys, ","),
+			m.Alliances["red"].Score, m.Alliances["blue"].Score, m.WinningAlliance, matchPlayedAt(m), start)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// teamMatches returns a team's played matches in a season from the cache,
+// fetching them from TBA the first time. Seasons that were fetched after
+// they ended never change, the current one is refetched now and then.
+func teamMatches(team string, year int) ([]tbaMatch, error) {
+	// Seasons cached before event start dates were stored count as stale.
+	var fetched time.Time
+	err := db.QueryRow(`SELECT Fetched_At FROM Team_Match_Years WHERE Team = $1 AND Year = $2
+		AND NOT EXISTS (SELECT 1 FROM Team_Matches WHERE Team = $1 AND Year = $2 AND Event_Start = '')`,
+		team, year).Scan(&fetched)
+	stale := err != nil || (fetched.Year() <= year && time.Since(fetched) > teamMatchesTTL)
+
+	if stale {
+		matches, err := tbaTeamMatches(team, year)
+		if err = ignoreNotFound(err); err != nil {
+			return nil, err
+		}
+		events, err := tbaTeamEvents(team, year)
+		if err = ignoreNotFound(err); err != nil {
+			return nil, err
+		}
+		starts := map[string]string{}
+		for _, e := range events {
+			starts[e.Key] = e.StartDate
+		}
+		if err = cacheTeamMatches(team, year, matches, starts); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.Query(`SELECT Match_Key, Event, Comp_Level, Set_Number, Match_Number, Red, Blue, Red_Score, Blue_Score, Winner, Played_At,
+		Event_Start FROM Team_Matches WHERE Team = $1 AND Year = $2`, team, year)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []tbaMatch
+	starts := map[string]string{}
+	for rows.Next() {
+		var m tbaMatch
+		var red, blue, start string
+		var redScore, blueScore int
+		err = rows.Scan(&m.Key, &m.EventKey, &m.CompLevel, &m.SetNumber, &m.MatchNumber, &red, &blue,
+			&redScore, &blueScore, &m.WinningAlliance, &m.ActualTime, &start)
+		if err != nil {
+			return nil, err
+		}
+		m.Alliances = map[string]*tbaMatchAlliance{
+			"red":  {TeamKeys: strings.Split(red, ","), Score: redScore},
+			"blue": {TeamKeys: strings.Split(blue, ","), Score: blueScore},
+		}
+		starts[m.EventKey] = start
+		matches = append(matches, m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Older seasons have no match times, so order by when each event started
+	// and then by the order matches are played within it.
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := &matches[i], &matches[j]
+		if starts[a.EventKey] != starts[b.EventKey] {
+			return starts[a.EventKey] < starts[b.EventKey]
+		}
+		if a.EventKey != b.EventKey {
+			return a.EventKey < b.EventKey
+		}
+		return matchLess(a, b)
+	})
+	return matches, nil
+}
+
+// h2hYears works out the seasons to look at from an optional year or range
+// such as 2015-2019, limited to seasons both teams played.
+func h2hYears(a, b, raw string) ([]int, error) {
+	from, to := 0, time.Now().Year()
+	if raw != "" {
+		match := yearRangeRegex.FindStringSubmatch(raw)
+		if match == nil {
+			return nil, usageError(fmt.Sprintf("%q isn't a year like 2019 or a range like 2015-2019", raw))
+		}
+		from, _ = strconv.Atoi(match[1])
+		to = from
+		if match[2] != "" {
+			to, _ = strconv.Atoi(match[2])
+		}
+	}
+
+	aYears, err := tbaTeamYears(a)
+	if err != nil {
+		return nil, err
+	}
+	bYears, err := tbaTeamYears(b)
+	if err != nil {
+		return nil, err
+	}
+
+	played := map[int]bool{}
+	for _, year := range bYears {
+		played[year] = true
+	}
+	var years []int
+	for _, year := range aYears {
+		if played[year] && year >= from && year <= to {
+			years = append(years, year)
+		}
+	}
+	sort.Ints(years)
+	return years, nil
+}
+
+// meeting describes a match two teams were both in, from a's point of view.
+func meeting(m *tbaMatch, a, b string) string {
+	colorA, colorB := m.allianceOf(teamKey(a)), m.allianceOf(teamKey(b))
+	score := fmt.Sprintf("%d-%d", m.Alliances[colorA].Score, m.Alliances[opponent(colorA)].Score)
+	name := m.EventKey + " " + shortMatchName(m)
+
+	if colorA == colorB {
+		return fmt.Sprintf("%s: partners, %s %s", name, m.outcome(colorA), score)
+	}
+	switch m.outcome(colorA) {
+	case "W":
+		return fmt.Sprintf("%s: %s beat %s %s", name, a, b, score)
+	case "L":
+		return fmt.Sprintf("%s: %s beat %s %d-%d", name, b, a, m.Alliances[colorB].Score, m.Alliances[colorA].Score)
+	}
+	return fmt.Sprintf("%s: %s and %s tied %s", name, a, b, score)
+}
+
+type h2hRecord struct {
+	wins, losses, ties int
+}
+
+func (r *h2hRecord) add(outcome string) {
+	switch outcome {
+	case "W":
+		r.wins++
+	case "L":
+		r.losses++
+	default:
+		r.ties++
+	}
+}
+
+func (r *h2hRecord) matches() int {
+	return r.wins + r.losses + r.ties
+}
+
+func (r *h2hRecord) String() string {
+	return fmt.Sprintf("%d-%d-%d", r.wins, r.losses, r.ties)
+}
+
+func h2hCommand(ctx *commandContext) error {
+	a, b := ctx.str("team"), ctx.str("other")
+	if a == b {
+		return commandError("Pick two different teams.")
+	}
+
+	years, err := h2hYears(a, b, ctx.str("years"))
+	if err != nil {
+		return err
+	}
+	if len(years) == 0 {
+		return commandError(fmt.Sprintf("Teams %s and %s never competed in the same season.", a, b))
+	}
+
+	var together []tbaMatch
+	for _, year := range years {
+		matches, err := teamMatches(a, year)
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			if m.allianceOf(teamKey(b)) != "" {
+				together = append(together, m)
+			}
+		}
+	}
+
+	span := fmt.Sprintf("%d-%d", years[0], years[len(years)-1])
+	if years[0] == years[len(years)-1] {
+		span = fmt.Sprintf("%d", years[0])
+	}
+	title := fmt.Sprintf("%s and %s head to head", a, b)
+	if len(together) == 0 {
+		_, err = ctx.replyEmbed(&discordgo.MessageEmbed{
+			Title:       title,
+			Color:       tbaColor,
+			Description: fmt.Sprintf("They never played in the same match in %s.", span),
+		})
+		return err
+	}
+
+	var partners, opponents h2hRecord
+	var playoffs []string
+	for i := range together {
+		m := &together[i]
+		colorA := m.allianceOf(teamKey(a))
+		if colorA == m.allianceOf(teamKey(b)) {
+			partners.add(m.outcome(colorA))
+		} else {
+			opponents.add(m.outcome(colorA))
+		}
+		if m.CompLevel != "qm" {
+			playoffs = append(playoffs, meeting(m, a, b))
+		}
+	}
+
+	opposed := "never"
+	if opponents.matches() > 0 {
+		opposed = fmt.Sprintf("%d matches, %s is %s against %s", opponents.matches(), a, opponents.String(), b)
+	}
+	paired := "never"
+	if partners.matches() > 0 {
+		paired = fmt.Sprintf("%d matches, %s together", partners.matches(), partners.String())
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       title,
+		Color:       tbaColor,
+		Description: fmt.Sprintf("%d matches together in %s", len(together), span),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "As partners", Value: paired},
+			{Name: "As opponents", Value: opposed},
+			{Name: "First meeting", Value: meeting(&together[0], a, b), Inline: true},
+			{Name: "Most recent", Value: meeting(&together[len(together)-1], a, b), Inline: true},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: "Records are W-L-T"},
+	}
+	if len(playoffs) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("Playoff meetings (%d)", len(playoffs)),
+			Value: truncate(strings.Join(playoffs, "\n"), 1024),
+		})
+	}
+
+	_, err = ctx.replyEmbed(embed)
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "h2h",
+		aliases: []string{"headtohead"},
+		summary: "Show how two teams have done with and against each other.",
+		help:    "Give a year or a range like 2015-2019 to only look at those seasons.",
+		args: []argSpec{
+			{name: "team", kind: argTeam},
+			{name: "other", kind: argTeam},
+			{name: "years", optional: true},
+		},
+		run: h2hCommand,
+	})
+}
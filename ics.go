@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	icsDateFmt     = "20060102"
+	icsDateTimeFmt = "20060102T150405Z"
+)
+
+// icsEvent is a single VEVENT in an iCalendar feed.
+type icsEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+
+	// Alarm, if set, adds a reminder that long before the start.
+	Alarm time.Duration
+}
+
+// icsEscaper escapes TEXT values. Windows line endings from Discord are
+// folded into a single newline so no bare carriage return ends up in the feed.
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// icsLine writes a content line, folded at 75 octets as RFC 5545 requires.
+func icsLine(buf *bytes.Buffer, name, value string) {
+	line := name + ":" + value
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		// Don't split a UTF-8 sequence.
+		for cut > 0 && line[cut]&0xc0 == 0x80 {
+			cut--
+		}
+		buf.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts.
+		limit = 74
+	}
+	buf.WriteString(line + "\r\n")
+}
+
+// writeICS renders a calendar with the given name.
+func writeICS(name string, events []icsEvent) []byte {
+	var buf bytes.Buffer
+	icsLine(&buf, "BEGIN", "VCALENDAR")
+	icsLine(&buf, "VERSION", "2.0")
+	icsLine(&buf, "PRODID", "-//tbc-discord-bot//EN")
+	icsLine(&buf, "CALSCALE", "GREGORIAN")
+	icsLine(&buf, "X-WR-CALNAME", icsEscaper.Replace(name))
+
+	stamp := time.Now().UTC().Format(icsDateTimeFmt)
+	for _, e := range events {
+		icsLine(&buf, "BEGIN", "VEVENT")
+		icsLine(&buf, "UID", e.UID)
+		icsLine(&buf, "DTSTAMP", stamp)
+		if e.AllDay {
+			icsLine(&buf, "DTSTART;VALUE=DATE", e.Start.Format(icsDateFmt))
+			// All day events end on the day after the last one.
+			icsLine(&buf, "DTEND;VALUE=DATE", e.End.AddDate(0, 0, 1).Format(icsDateFmt))
+		} else {
+			icsLine(&buf, "DTSTART", e.Start.UTC().Format(icsDateTimeFmt))
+			icsLine(&buf, "DTEND", e.End.UTC().Format(icsDateTimeFmt))
+		}
+		icsLine(&buf, "SUMMARY", icsEscaper.Replace(e.Summary))
+		if e.Description != "" {
+			icsLine(&buf, "DESCRIPTION", icsEscaper.Replace(e.Description))
+		}
+		if e.Location != "" {
+			icsLine(&buf, "LOCATION", icsEscaper.Replace(e.Location))
+		}
+		if e.URL != "" {
+			icsLine(&buf, "URL", e.URL)
+		}
+		if e.Alarm > 0 {
+			icsLine(&buf, "BEGIN", "VALARM")
+			icsLine(&buf, "ACTION", "DISPLAY")
+			icsLine(&buf, "DESCRIPTION", icsEscaper.Replace(e.Summary))
+			icsLine(&buf, "TRIGGER", fmt.Sprintf("-PT%dM", int(e.Alarm.Minutes())))
+			icsLine(&buf, "END", "VALARM")
+		}
+		icsLine(&buf, "END", "VEVENT")
+	}
+	icsLine(&buf, "END", "VCALENDAR")
+	return buf.Bytes()
+}
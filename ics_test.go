@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICSEscaper(t *testing.T) {
+	tests := map[string]string{
+		"Week 1":                 "Week 1",
+		"Boston, MA; USA":        `Boston\, MA\; USA`,
+		`C:\drafts`:              `C:\\drafts`,
+		"line one\nline two":     `line one\nline two`,
+		"line one\r\nline two\r": `line one\nline two\n`,
+	}
+	for in, want := range tests {
+		if got := icsEscaper.Replace(in); got != want {
+			t.Errorf("icsEscaper.Replace(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestICSLine(t *testing.T) {
+	var buf bytes.Buffer
+	icsLine(&buf, "SUMMARY", "short")
+	if got := buf.String(); got != "SUMMARY:short\r\n" {
+		t.Errorf("icsLine = %q, want %q", got, "SUMMARY:short\r\n")
+	}
+
+	for _, value := range []string{
+		strings.Repeat("x", 200),
+		// Multibyte characters straddle the fold points.
+		strings.Repeat("é", 100),
+		strings.Repeat("a🤖", 50),
+	} {
+		buf.Reset()
+		icsLine(&buf, "DESCRIPTION", value)
+		out := buf.String()
+		if !strings.HasSuffix(out, "\r\n") {
+			t.Fatalf("icsLine(%q) doesn't end in CRLF", value)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+		unfolded := lines[0]
+		for i, line := range lines {
+			if len(line) > 75 {
+				t.Errorf("line %d is %d octets, longer than 75", i, len(line))
+			}
+			if !utf8.ValidString(line) {
+				t.Errorf("line %d splits a UTF-8 sequence: %q", i, line)
+			}
+			if i > 0 {
+				if !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d doesn't start with a space", i)
+				}
+				unfolded += line[1:]
+			}
+		}
+		if unfolded != "DESCRIPTION:"+value {
+			t.Errorf("unfolding gave %q, want %q", unfolded, "DESCRIPTION:"+value)
+		}
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	start := time.Date(2019, 3, 28, 0, 0, 0, 0, time.UTC)
+	out := string(writeICS("Silicon Valley, 2019", []icsEvent{{
+		UID:      "2019casj@tbc",
+		Summary:  "Silicon Valley Regional",
+		Location: "San Jose, CA",
+		Start:    start,
+		End:      start.AddDate(0, 0, 2),
+		AllDay:   true,
+	}}))
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Silicon Valley\\, 2019\r\n",
+		"DTSTART;VALUE=DATE:20190328\r\n",
+		// The end date is exclusive.
+		"DTEND;VALUE=DATE:20190331\r\n",
+		"LOCATION:San Jose\\, CA\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("feed is missing %q", want)
+		}
+	}
+	if strings.Contains(out, "DESCRIPTION") || strings.Contains(out, "VALARM") {
+		t.Error("feed has a description or alarm the event didn't set")
+	}
+}
+
+func TestWriteICSAlarm(t *testing.T) {
+	start := time.Date(2019, 3, 28, 19, 30, 0, 0, time.FixedZone("PDT", -7*60*60))
+	out := string(writeICS("Drafts", []icsEvent{{
+		UID:     "draft-1@tbc",
+		Summary: "Week 1 draft",
+		Start:   start,
+		End:     start.Add(time.Hour),
+		Alarm:   30 * time.Minute,
+	}}))
+
+	for _, want := range []string{
+		// Timed events are written in UTC.
+		"DTSTART:20190329T023000Z\r\n",
+		"DTEND:20190329T033000Z\r\n",
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nDESCRIPTION:Week 1 draft\r\nTRIGGER:-PT30M\r\nEND:VALARM\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("feed is missing %q", want)
+		}
+	}
+}
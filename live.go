@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Phases of an event that get announced to following channels, in order.
+const (
+	phaseNone     = ""
+	phaseQuals    = "quals"
+	phasePlayoffs = "playoffs"
+	phaseFinals   = "finals"
+)
+
+var phaseOrder = map[string]int{phaseNone: 0, phaseQuals: 1, phasePlayoffs: 2, phaseFinals: 3}
+
+// liveDatesTTL is how long followed events' dates are trusted before TBA is
+// asked again, in case an event is rescheduled.
+const liveDatesTTL = 24 * time.Hour
+
+type liveWindow struct {
+	start, end, fetched time.Time
+}
+
+// liveDates caches followed events' dates so announceLiveEvents only asks TBA
+// about events that are running.
+var (
+	liveDates      = map[string]liveWindow{}
+	liveDatesMutex = &sync.Mutex{}
+)
+
+// eventWindow returns an event's start and end dates, from the cache when
+// they are fresh.
+func eventWindow(event string) (start, end time.Time, err error) {
+	liveDatesMutex.Lock()
+	w, ok := liveDates[event]
+	liveDatesMutex.Unlock()
+	if ok && time.Since(w.fetched) < liveDatesTTL {
+		return w.start, w.end, nil
+	}
+
+	e, err := tbaEventInfo(event)
+	if err != nil {
+		return start, end, err
+	}
+	start, end = e.dates()
+
+	liveDatesMutex.Lock()
+	liveDates[event] = liveWindow{start: start, end: end, fetched: time.Now()}
+	liveDatesMutex.Unlock()
+	return start, end, nil
+}
+
+// webcastURL links to a TBA webcast, or returns "" for types without a
+// stable public link.
+func webcastURL(w tbaWebcast) string {
+	switch w.Type {
+	case "twitch":
+		return "https://www.twitch.tv/" + w.Channel
+	case "youtube":
+		return "https://www.youtube.com/watch?v=" + w.Channel
+	case "livestream":
+		return fmt.Sprintf("https://livestream.com/accounts/%s/events/%s", w.Channel, w.File)
+	case "direct_link":
+		return w.Channel
+	}
+	return ""
+}
+
+func webcastLinks(e *tbaEvent) string {
+	var links []string
+	for i, w := range e.Webcasts {
+		if u := webcastURL(w); u != "" {
+			links = append(links, fmt.Sprintf("[%s %d](%s)", strings.Title(strings.Replace(w.Type, "_", " ", -1)), i+1, u))
+		}
+	}
+	return strings.Join(links, " • ")
+}
+
+// matchPhase is the phase a match belongs to.
+func matchPhase(m *tbaMatch) string {
+	switch m.CompLevel {
+	case "qm":
+		return phaseQuals
+	case "f":
+		return phaseFinals
+	}
+	return phasePlayoffs
+}
+
+// currentPhase is the latest phase with a match that has been played or is
+// past its start time.
+func currentPhase(matches []tbaMatch) (string, *tbaMatch) {
+	phase := phaseNone
+	var first *tbaMatch
+	now := time.Now().Unix()
+	for i := range matches {
+		m := &matches[i]
+		start := matchTime(m)
+		if !m.played() && (start == 0 || start > now) {
+			continue
+		}
+
+		p := matchPhase(m)
+		if phaseOrder[p] > phaseOrder[phase] || (p == phase && matchLess(m, first)) {
+			phase, first = p, m
+		}
+	}
+	return phase, first
+}
+
+// allianceNumber finds which alliance a match's team list belongs to.
+func allianceNumber(alliances []tbaAlliance, teams []string) string {
+	for i, a := range alliances {
+		for _, pick := range a.Picks {
+			for _, team := range teams {
+				if pick == team {
+					if a.Name != "" {
+						return a.Name
+					}
+					return fmt.Sprintf("Alliance %d", i+1)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func liveEmbed(e *tbaEvent, phase string, first *tbaMatch) (*discordgo.MessageEmbed, error) {
+	embed := &discordgo.MessageEmbed{
+		URL:   "https://www.thebluealliance.com/event/" + e.Key,
+		Color: tbaColor,
+	}
+
+	switch phase {
+	case phaseQuals:
+		embed.Title = fmt.Sprintf(":red_circle: %d %s is live!", e.Year, e.Name)
+		embed.Description = "Qualification matches have started."
+
+	case phasePlayoffs, phaseFinals:
+		alliances, err := tbaEventAlliances(e.Key)
+		if err = ignoreNotFound(err); err != nil {
+			return nil, err
+		}
+
+		if phase == phasePlayoffs {
+			embed.Title = fmt.Sprintf(":trophy: Playoffs are starting at %s", e.Name)
+			var lines []string
+			for i, a := range alliances {
+				name := a.Name
+				if name == "" {
+					name = fmt.Sprintf("Alliance %d", i+1)
+				}
+				lines = append(lines, fmt.Sprintf("**%s**: %s", name, teamList(a.Picks)))
+			}
+			if len(lines) > 0 {
+				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Alliances", Value: truncate(strings.Join(lines, "\n"), 1024)})
+			}
+		} else {
+			embed.Title = fmt.Sprintf(":trophy: Finals are starting at %s", e.Name)
+			for _, color := range []string{"red", "blue"} {
+				teams := first.Alliances[color].TeamKeys
+				name := strings.Title(color)
+				if number := allianceNumber(alliances, teams); number != "" {
+					name += " - " + number
+				}
+				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: name, Value: teamList(teams), Inline: true})
+			}
+		}
+	}
+
+	if links := webcastLinks(e); links != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Watch", Value: links})
+	}
+	return embed, nil
+}
+
+// announceLiveEvents checks every followed event that is running and tells
+// its channels when qualifications, playoffs and finals start. A channel
+// only hears about the latest phase, so following mid-event doesn't replay
+// old announcements.
+func announceLiveEvents() {
+	dg := session
+	if dg == nil {
+		return
+	}
+
+	rows, err := db.Query("SELECT Channel, Target FROM Follows WHERE Kind = $1", followEvent)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	followers := map[string][]string{}
+	for rows.Next() {
+		var channel, event string
+		if err = rows.Scan(&channel, &event); err != nil {
+			log.Println(err)
+			break
+		}
+		followers[event] = append(followers[event], channel)
+	}
+	rows.Close()
+
+	now := time.Now()
+	for event, channels := range followers {
+		// Event keys start with their season, and only this season's
+		// events can be live.
+		if len(event) < 4 {
+			continue
+		}
+		if year, err := strconv.Atoi(event[:4]); err != nil || year != now.Year() {
+			continue
+		}
+		start, end, err := eventWindow(event)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if now.Before(start.AddDate(0, 0, -1)) || now.After(end.AddDate(0, 0, 2)) {
+			continue
+		}
+
+		matches, err := tbaEventMatches(event)
+		if err = ignoreNotFound(err); err != nil {
+			log.Println(err)
+			continue
+		}
+		phase, first := currentPhase(matches)
+		if phase == phaseNone {
+			continue
+		}
+
+		// The announcement row claims the phase for a channel so overlapping
+		// runs don't both post it. It is released again if the post fails, so
+		// the next run retries.
+		var embed *discordgo.MessageEmbed
+		for _, channel := range channels {
+			res, err := db.Exec(`INSERT INTO Event_Announcements (Channel, Event, Phase, Announced_At) VALUES ($1, $2, $3, $4)
+				ON CONFLICT DO NOTHING`, channel, event, phase, now)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				continue
+			}
+
+			if embed == nil {
+				e, err := tbaEventInfo(event)
+				if err == nil {
+					embed, err = liveEmbed(e, phase, first)
+				}
+				if err != nil {
+					log.Println(err)
+					unclaimAnnouncement(channel, event, phase)
+					break
+				}
+			}
+			if _, err = dg.ChannelMessageSendEmbed(channel, embed); err != nil {
+				log.Println(err)
+				unclaimAnnouncement(channel, event, phase)
+			}
+		}
+	}
+}
+
+// unclaimAnnouncement forgets that a phase was announced in a channel.
+func unclaimAnnouncement(channel, event, phase string) {
+	_, err := db.Exec("DELETE FROM Event_Announcements WHERE Channel = $1 AND Event = $2 AND Phase = $3", channel, event, phase)
+	if err != nil {
+		log.Println(err)
+	}
+}
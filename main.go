@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -26,7 +27,10 @@ import (
 var (
 	token         string
 	authKey       string
+	publicURL     string
+	adminToken    string
 	tRegex        = regexp.MustCompile("\\[\\[(?:(\\d+)(?:@(\\w+))?)\\]\\]")
+	eventKeyRegex = regexp.MustCompile(`^\d{4}[a-z0-9]+$`)
 	pRegex        = regexp.MustCompile("")
 	nameRegex     = `(\w+)`
 	urlRegex      = `([-a-zA-Z0-9@:%._\/\+~#=]{2,256}\.[a-z]{2,6}\b[-a-zA-Z0-9@:%_\+.~#?&//=]*)`
@@ -35,12 +39,26 @@ var (
 	draftRegex    = regexp.MustCompile("(?m:Name: " + nameRegex + "\nTeams: " + urlRegex + "\nRounds: " + roundsRegex + "\nDate: " + dateRegex + ")")
 	dateTimeFmt   = "01/02@15:04"
 	tbaHeader     http.Header
-	insertDraft   = "INSERT INTO Drafts (Name, Teams, Rounds, Date, Guild, Orig_ch, Msg) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	insertDraft   = "INSERT INTO Drafts (Name, Teams, Rounds, Date, Guild, Orig_ch, Msg) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING Draft_Key"
 	insertDateFmt = "2006-01-02 15:04:05"
 	mutex         = &sync.Mutex{}
 	db            *sql.DB
+	session       *discordgo.Session
 )
 
+// requireAdminToken guards maintenance routes that rewrite data or make many
+// TBA requests. The token comes from the X-Admin-Token header or the token
+// query parameter, and the routes are disabled when ADMIN_TOKEN isn't set.
+func requireAdminToken(c *gin.Context) {
+	given := c.GetHeader("X-Admin-Token")
+	if given == "" {
+		given = c.Query("token")
+	}
+	if adminToken == "" || subtle.ConstantTimeCompare([]byte(given), []byte(adminToken)) != 1 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
 func makeRequest(method, url string) (out []byte, err error) {
 	req, err := http.NewRequest(method, url, strings.NewReader(""))
 	if err != nil {
@@ -136,36 +154,41 @@ func getTeamEventStatus(team, event string, year int) string {
 	return parsed["overall_status_str"].(string)
 }
 
+func teamStatusString(team string) string {
+	var status string
+	eventCode, event := determineEvent(team, time.Now().Year())
+	if eventCode == "" {
+		status = "***Come on Joe, you know better.***"
+	} else {
+		status = fmt.Sprintf("At %s, %s", event, getTeamEventStatus(team, eventCode, time.Now().Year()))
+	}
+
+	status = strings.Replace(status, "<b>", "**", -1)
+	status = strings.Replace(status, "</b>", "**", -1)
+	return status
+}
+
 func teamStatus(dg *discordgo.Session, msg *discordgo.MessageCreate) {
-	if msg.Author.ID == dg.State.User.ID {
+	if !tRegex.MatchString(msg.Content) || !guildSettingsFor(messageGuild(dg, msg.ChannelID)).MentionLookups {
 		return
 	}
 
 	for _, match := range tRegex.FindAllStringSubmatch(msg.Content, -1) {
-		var event string
-		var eventCode string
-		if match[2] == "" { // figure out event to report on
-			eventCode, event = determineEvent(match[1], time.Now().Year())
+		if match[2] != "" {
+			dg.ChannelMessageSend(msg.ChannelID, "***Come on Joe, you know better.***")
+			continue
 		}
 
-		var status string
-		if eventCode == "" {
-			status = "***Come on Joe, you know better.***"
-		} else {
-			status = fmt.Sprintf("At %s, %s", event, getTeamEventStatus(match[1], eventCode, time.Now().Year()))
-		}
-
-		status = strings.Replace(status, "<b>", "**", -1)
-		status = strings.Replace(status, "</b>", "**", -1)
-		dg.ChannelMessageSend(msg.ChannelID, status)
+		dg.ChannelMessageSend(msg.ChannelID, teamStatusString(match[1]))
 	}
 }
 
-func draftProposal(dg *discordgo.Session, msg *discordgo.MessageCreate) {
-	if msg.Author.ID == dg.State.User.ID {
-		return
-	}
+func statusCommand(ctx *commandContext) error {
+	_, err := ctx.reply(teamStatusString(ctx.str("team")))
+	return err
+}
 
+func draftProposal(dg *discordgo.Session, msg *discordgo.MessageCreate) {
 	prop := draftRegex.FindStringSubmatch(msg.Content)
 	if prop == nil {
 		return
@@ -180,46 +203,66 @@ func draftProposal(dg *discordgo.Session, msg *discordgo.MessageCreate) {
 		log.Println(err)
 	}
 
-	dt, err := time.Parse(dateTimeFmt, prop[4])
+	ch, err := dg.Channel(msg.ChannelID)
 	if err != nil {
-		log.Println(err)
+		log.Fatal(err)
 	}
 
-	dt = dt.AddDate(time.Now().Year(), 0, 0)
+	guild := ch.GuildID
 
-	ch, err := dg.Channel(msg.ChannelID)
+	dt, err := time.ParseInLocation(dateTimeFmt, prop[4], guildSettingsFor(guild).location())
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
 	}
 
-	guild := ch.GuildID
+	// Drafts.Date has no zone, so it always holds UTC.
+	dt = dt.AddDate(time.Now().Year(), 0, 0).UTC()
 
 	log.Println(prop[1], prop[2], rounds, dt, guild)
 
-	_, err = db.Exec(insertDraft, prop[1], prop[2], rounds, dt, guild, msg.ChannelID, msg.ID)
+	d := &draft{
+		Name:   prop[1],
+		Teams:  prop[2],
+		Rounds: int(rounds),
+		Date:   dt,
+		Guild:  guild,
+		OrigCh: msg.ChannelID,
+		Msg:    msg.ID,
+		Status: draftProposed,
+	}
+	err = db.QueryRow(insertDraft, d.Name, d.Teams, d.Rounds, d.Date, d.Guild, d.OrigCh, d.Msg).Scan(&d.Key)
 	if err != nil {
 		log.Println(err)
+		return
 	}
-}
 
-func getDrafts() {
-	dg, err := discordgo.New("Bot " + token)
+	err = postRoster(dg, d)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
 	}
 
-	err = dg.Open()
+	err = postDraftICS(dg, d)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+	}
+}
+
+func getDrafts() {
+	dg := session
+	if dg == nil {
+		log.Println("getDrafts: discord is not connected yet")
+		return
 	}
 
-	today := time.Now()
+	today := time.Now().UTC()
 	tomorrow := today.AddDate(0, 0, 1)
 	log.Println(today, tomorrow)
 	rows, err := db.Query("SELECT Draft_Key, Name, Teams, Rounds, Date, Guild, Orig_ch, Msg FROM Drafts WHERE COALESCE(Channel, '') = '' AND Date BETWEEN $1 AND $2", today, tomorrow)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		return
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var key int
@@ -233,50 +276,61 @@ func getDrafts() {
 
 		err = rows.Scan(&key, &name, &teams, &rounds, &date, &guild, &orig_ch, &msgID)
 		if err != nil {
-			log.Fatal(err)
+			log.Println(err)
+			continue
 		}
 
 		log.Println(key, name, teams, rounds, date, guild)
 
+		settings := guildSettingsFor(guild)
 		name = strings.Replace(strings.TrimSpace(name), " ", "-", -1)
-		ch, err := dg.GuildChannelCreate(guild, "draft-"+name, "0")
+		role, err := createDrafterRole(dg, settings, name)
 		if err != nil {
-			log.Fatal(err)
+			notifyDraftFailure(dg, settings, orig_ch, name, err)
+			continue
 		}
 
-		_, err = db.Exec("UPDATE Drafts SET Channel = $1 WHERE Draft_Key = $2", ch.ID, key)
+		ch, err := createDraftChannel(dg, settings, name, "Teams: "+teams, role.ID)
 		if err != nil {
-			log.Fatal(err)
+			notifyDraftFailure(dg, settings, orig_ch, name, err)
+			if err = dg.GuildRoleDelete(guild, role.ID); err != nil {
+				log.Println(err)
+			}
+			continue
 		}
 
-		role, err := dg.GuildRoleCreate(guild)
+		// Without the channel recorded the next run would make another one,
+		// so undo this run's setup and let it try again.
+		_, err = db.Exec("UPDATE Drafts SET Channel = $1, Role = $2, Status = $3 WHERE Draft_Key = $4", ch.ID, role.ID, draftActive, key)
 		if err != nil {
-			log.Fatal(err)
+			notifyDraftFailure(dg, settings, orig_ch, name, err)
+			if _, err = dg.ChannelDelete(ch.ID); err != nil {
+				log.Println(err)
+			}
+			if err = dg.GuildRoleDelete(guild, role.ID); err != nil {
+				log.Println(err)
+			}
+			continue
 		}
 
-		role, err = dg.GuildRoleEdit(guild, role.ID, name+" Drafter", role.Color, false, role.Permissions, true)
+		// A missing signup message or a member who left shouldn't stop the
+		// draft from being announced, so these failures are only logged.
+		signups, err := draftSignups(dg, &draft{Key: key, Guild: guild, OrigCh: orig_ch, Msg: msgID})
 		if err != nil {
-			log.Fatal(err)
+			log.Println(err)
 		}
 
-		message, err := dg.ChannelMessage(orig_ch, msgID)
-		if err != nil {
-			log.Fatal(err)
-		}
-		for _, reaction := range message.Reactions {
-			users, err := dg.MessageReactions(orig_ch, msgID, reaction.Emoji.ID, 100)
+		for _, member := range signups {
+			err = dg.GuildMemberRoleAdd(guild, member, role.ID)
 			if err != nil {
-				log.Fatal(err)
-			}
-
-			for _, user := range users {
-				err = dg.GuildMemberRoleAdd(guild, user.ID, role.ID)
-				if err != nil {
-					log.Fatal(err)
-				}
+				log.Println(err)
 			}
 		}
 
+		err = announceDraft(dg, ch.ID, role.ID, name, rounds)
+		if err != nil {
+			log.Println(err)
+		}
 	}
 }
 
@@ -288,19 +342,41 @@ func setupDiscord() {
 		log.Fatal(err)
 	}
 
-	dg.AddHandler(teamStatus)
-	dg.AddHandler(draftProposal)
+	dg.AddHandler(handleMessage)
+	dg.AddHandler(signupAdded)
+	dg.AddHandler(signupRemoved)
+	dg.AddHandler(paginatorReaction)
+	dg.AddHandler(pickemAdded)
+	dg.AddHandler(pickemRemoved)
 
 	err = dg.Open()
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	session = dg
+}
+
+func init() {
+	registerListener(teamStatus)
+	registerListener(draftProposal)
+
+	registerCommand(&command{
+		name:    "status",
+		aliases: []string{"s"},
+		summary: "Show a team's status at its current or most recent event.",
+		help:    "You can also write [[254]] anywhere in a message.",
+		args:    []argSpec{{name: "team", kind: argTeam}},
+		run:     statusCommand,
+	})
 }
 
 func main() {
 	token = os.Getenv("TOKEN")
 	port := os.Getenv("PORT")
 	authKey = os.Getenv("XTBAAUTHKEY")
+	publicURL = strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	adminToken = os.Getenv("ADMIN_TOKEN")
 	tbaHeader = make(http.Header)
 	tbaHeader.Add("X-TBA-Auth-Key", authKey)
 
@@ -320,8 +396,20 @@ func main() {
 		log.Fatal(err)
 	}
 
+	migrate()
+	loadElo()
+
 	c := cron.New()
 	c.AddFunc("@midnight", getDrafts)
+	c.AddFunc("@hourly", cleanupDrafts)
+	c.AddFunc("@every 1m", sendDraftReminders)
+	c.AddFunc("@every 15m", updateElo)
+	c.AddFunc("@every 5m", updatePickem)
+	c.AddFunc("@every 2m", announceLiveEvents)
+	c.AddFunc("@every 3m", updateBracketPins)
+	c.AddFunc("@every 30s", updateAllselBoards)
+	c.AddFunc("0 0 14 * * *", cmpDigest)
+	c.AddFunc("0 30 * * * *", indexAwardSeasons)
 	go c.Run()
 
 	router := gin.New()
@@ -335,6 +423,34 @@ func main() {
 		c.String(http.StatusOK, string("Pulling Drafts..."))
 	})
 
+	router.GET("/updateElo", requireAdminToken, func(c *gin.Context) {
+		go updateElo()
+		c.String(http.StatusOK, string("Updating Elo..."))
+	})
+
+	router.GET("/rebuildElo", requireAdminToken, func(c *gin.Context) {
+		from, err := strconv.Atoi(c.DefaultQuery("from", strconv.Itoa(time.Now().Year()-eloBackfillSeasons)))
+		if err != nil {
+			c.String(http.StatusBadRequest, string("from must be a year"))
+			return
+		}
+		go rebuildElo(from)
+		c.String(http.StatusOK, fmt.Sprintf("Rebuilding Elo from %d...", from))
+	})
+
+	router.GET("/events.ics", eventsFeed)
+	router.GET("/drafts.ics", draftsFeed)
+
+	router.GET("/indexAwards", requireAdminToken, func(c *gin.Context) {
+		year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(time.Now().Year())))
+		if err != nil {
+			c.String(http.StatusBadRequest, string("year must be a year"))
+			return
+		}
+		go reindexAwards(year)
+		c.String(http.StatusOK, fmt.Sprintf("Indexing %d awards...", year))
+	})
+
 	go setupDiscord()
 
 	router.Run(":" + port)
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	redColor  = 0xed1c24
+	blueColor = 0x0066b3
+)
+
+var (
+	matchKeyRegex   = regexp.MustCompile(`^(?:(\d{4}[a-z0-9]+)_)?(qm|q|ef|qf|sf|f)(\d+)(?:m(\d+))?$`)
+	compLevelNames  = map[string]string{"qm": "Quals", "ef": "Octofinal", "qf": "Quarterfinal", "sf": "Semifinal", "f": "Final"}
+	compLevelOrders = map[string]int{"qm": 0, "ef": 1, "qf": 2, "sf": 3, "f": 4}
+)
+
+// breakdownField is one row of the per-season score breakdown table.
+type breakdownField struct {
+	label string
+	key   string
+}
+
+// breakdownFields lists the interesting score_breakdown keys for each season.
+// The auto/teleop/foul totals shared by every season are added separately,
+// and seasons missing here, or whose keys TBA doesn't send, show the raw
+// numeric fields instead.
+var breakdownFields = map[int][]breakdownField{
+	2018: {
+		{"Auto ownership", "autoOwnershipPoints"},
+		{"Teleop ownership", "teleopOwnershipPoints"},
+		{"Vault", "vaultPoints"},
+		{"Endgame", "endgamePoints"},
+		{"Auto quest RP", "autoQuestRankingPoint"},
+		{"Face the boss RP", "faceTheBossRankingPoint"},
+	},
+	2019: {
+		{"Sandstorm bonus", "sandStormBonusPoints"},
+		{"Hatch panels", "hatchPanelPoints"},
+		{"Cargo", "cargoPoints"},
+		{"HAB climb", "habClimbPoints"},
+		{"Rocket RP", "completeRocketRankingPoint"},
+		{"HAB docking RP", "habDockingRankingPoint"},
+	},
+	2020: {
+		{"Auto cells", "autoCellPoints"},
+		{"Teleop cells", "teleopCellPoints"},
+		{"Control panel", "controlPanelPoints"},
+		{"Endgame", "endgamePoints"},
+		{"Shield operational RP", "shieldOperationalRankingPoint"},
+		{"Shield energized RP", "shieldEnergizedRankingPoint"},
+	},
+	2022: {
+		{"Auto cargo", "autoCargoPoints"},
+		{"Teleop cargo", "teleopCargoPoints"},
+		{"Endgame", "endgamePoints"},
+		{"Cargo bonus RP", "cargoBonusRankingPoint"},
+		{"Hangar bonus RP", "hangarBonusRankingPoint"},
+	},
+	2023: {
+		{"Auto charge station", "autoChargeStationPoints"},
+		{"Game pieces", "teleopGamePiecePoints"},
+		{"Links", "linkPoints"},
+		{"Endgame charge station", "endGameChargeStationPoints"},
+		{"Sustainability RP", "sustainabilityBonusAchieved"},
+		{"Activation RP", "activationBonusAchieved"},
+	},
+	2024: {
+		{"Leave", "autoLeavePoints"},
+		{"Auto speaker", "autoSpeakerNotePoints"},
+		{"Teleop speaker", "teleopSpeakerNotePoints"},
+		{"Teleop amp", "teleopAmpNotePoints"},
+		{"Stage", "endGameTotalStagePoints"},
+		{"Melody RP", "melodyBonusAchieved"},
+		{"Ensemble RP", "ensembleBonusAchieved"},
+	},
+	2025: {
+		{"Leave", "autoMobilityPoints"},
+		{"Auto coral", "autoCoralPoints"},
+		{"Teleop coral", "teleopCoralPoints"},
+		{"Algae", "algaePoints"},
+		{"Barge", "endGameBargePoints"},
+		{"Auto RP", "autoBonusAchieved"},
+		{"Coral RP", "coralBonusAchieved"},
+		{"Barge RP", "bargeBonusAchieved"},
+	},
+	2026: {
+		{"Auto fuel", "autoFuelPoints"},
+		{"Teleop fuel", "teleopFuelPoints"},
+		{"Tower", "endGameTowerPoints"},
+		{"Energized RP", "energizedAchieved"},
+		{"Supercharged RP", "superchargedAchieved"},
+		{"Traversal RP", "traversalAchieved"},
+	},
+}
+
+// breakdownMax keeps the table inside an embed field.
+const breakdownMax = 1024
+
+var commonBreakdownFields = []breakdownField{
+	{"Auto", "autoPoints"},
+	{"Teleop", "teleopPoints"},
+	{"Fouls", "foulPoints"},
+}
+
+// matchName turns a match into something like "Quals 42" or "Semifinal 2
+// Match 1".
+func matchName(m *tbaMatch) string {
+	name := compLevelNames[m.CompLevel]
+	if m.CompLevel == "qm" {
+		return fmt.Sprintf("%s %d", name, m.MatchNumber)
+	}
+	return fmt.Sprintf("%s %d Match %d", name, m.SetNumber, m.MatchNumber)
+}
+
+// shortMatchName is the compact form used in tables, such as qm42 or sf2m1.
+func shortMatchName(m *tbaMatch) string {
+	if m.CompLevel == "qm" {
+		return fmt.Sprintf("qm%d", m.MatchNumber)
+	}
+	return fmt.Sprintf("%s%dm%d", m.CompLevel, m.SetNumber, m.MatchNumber)
+}
+
+// matchLess orders matches the way they are played.
+func matchLess(a, b *tbaMatch) bool {
+	if compLevelOrders[a.CompLevel] != compLevelOrders[b.CompLevel] {
+		return compLevelOrders[a.CompLevel] < compLevelOrders[b.CompLevel]
+	}
+	if a.SetNumber != b.SetNumber && a.CompLevel != "qm" {
+		return a.SetNumber < b.SetNumber
+	}
+	return a.MatchNumber < b.MatchNumber
+}
+
+// resolveMatchKey expands a match argument into a full TBA match key, using
+// the channel's followed event when the event is left out.
+func resolveMatchKey(channelID, raw string) (string, error) {
+	match := matchKeyRegex.FindStringSubmatch(strings.ToLower(raw))
+	if match == nil {
+		return "", usageError(fmt.Sprintf("%q isn't a match like 2019casj_qm42 or qm42", raw))
+	}
+
+	event := match[1]
+	if event == "" {
+		followed, err := followedEvent(channelID)
+		if err != nil {
+			return "", err
+		}
+		if followed == "" {
+			return "", commandError("This channel doesn't follow an event, so use a full match key like 2019casj_qm42.")
+		}
+		event = followed
+	}
+
+	level := match[2]
+	if level == "q" {
+		level = "qm"
+	}
+
+	key := fmt.Sprintf("%s_%s%s", event, level, match[3])
+	if level != "qm" {
+		number := match[4]
+		if number == "" {
+			number = "1"
+		}
+		key += "m" + number
+	}
+	return key, nil
+}
+
+func breakdownValue(v interface{}) string {
+	switch value := v.(type) {
+	case float64:
+		return fmt.Sprintf("%g", value)
+	case bool:
+		if value {
+			return "yes"
+		}
+		return "no"
+	case string:
+		return value
+	case nil:
+		return "-"
+	}
+	return fmt.Sprint(v)
+}
+
+// breakdownTable renders the season's score breakdown as a two column table.
+func breakdownTable(m *tbaMatch, year int) string {
+	red, blue := m.ScoreBreakdown["red"], m.ScoreBreakdown["blue"]
+	if red == nil || blue == nil {
+		return ""
+	}
+
+	season := breakdownFields[year]
+	var keys []string
+	for _, field := range season {
+		keys = append(keys, field.key)
+	}
+	missing := missingBreakdownKeys([]tbaMatch{*m}, keys)
+	if len(missing) > 0 {
+		log.Printf("breakdown: %s has no %s\n", m.Key, strings.Join(missing, ", "))
+	}
+	if len(missing) == len(season) {
+		season = rawBreakdownFields(red, blue)
+	}
+	fields := append(append([]breakdownField{}, commonBreakdownFields...), season...)
+	if m.CompLevel == "qm" {
+		fields = append(fields, breakdownField{"Ranking points", "rp"})
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "```\n%-24s %6s %6s\n", "", "Red", "Blue")
+	for _, field := range fields {
+		r, rok := red[field.key]
+		b, bok := blue[field.key]
+		if !rok && !bok {
+			continue
+		}
+		row := fmt.Sprintf("%-24.24s %6s %6s\n", field.label, breakdownValue(r), breakdownValue(b))
+		if buf.Len()+len(row)+3 > breakdownMax {
+			break
+		}
+		buf.WriteString(row)
+	}
+	buf.WriteString("```")
+	return buf.String()
+}
+
+// missingBreakdownKeys lists the keys that no played match's score breakdown
+// has for either alliance. Matches without a breakdown are skipped, so it's
+// empty when TBA hasn't published any.
+func missingBreakdownKeys(matches []tbaMatch, keys []string) []string {
+	seen := map[string]bool{}
+	found := false
+	for i := range matches {
+		m := &matches[i]
+		if !m.played() {
+			continue
+		}
+		for _, color := range []string{"red", "blue"} {
+			breakdown := m.ScoreBreakdown[color]
+			if breakdown == nil {
+				continue
+			}
+			found = true
+			for _, key := range keys {
+				if _, ok := breakdown[key]; ok {
+					seen[key] = true
+				}
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	var missing []string
+	for _, key := range keys {
+		if !seen[key] {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// rawBreakdownFields lists every numeric score_breakdown key by name, for
+// seasons breakdownFields doesn't know yet.
+func rawBreakdownFields(red, blue map[string]interface{}) []breakdownField {
+	skip := map[string]bool{"rp": true, "totalPoints": true}
+	for _, field := range commonBreakdownFields {
+		skip[field.key] = true
+	}
+
+	var fields []breakdownField
+	for key, v := range red {
+		if _, ok := v.(float64); !ok || skip[key] {
+			continue
+		}
+		if _, ok := blue[key].(float64); !ok {
+			continue
+		}
+		fields = append(fields, breakdownField{key, key})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+	return fields
+}
+
+func allianceTeams(a *tbaMatchAlliance) string {
+	if a == nil {
+		return "-"
+	}
+
+	surrogates := map[string]bool{}
+	for _, key := range a.SurrogateTeamKeys {
+		surrogates[key] = true
+	}
+	dqs := map[string]bool{}
+	for _, key := range a.DqTeamKeys {
+		dqs[key] = true
+	}
+
+	var teams []string
+	for _, key := range a.TeamKeys {
+		team := strings.TrimPrefix(key, "frc")
+		if surrogates[key] {
+			team += "*"
+		}
+		if dqs[key] {
+			team = "~~" + team + "~~"
+		}
+		teams = append(teams, team)
+	}
+	return strings.Join(teams, ", ")
+}
+
+func videoLinks(m *tbaMatch) string {
+	var links []string
+	for i, video := range m.Videos {
+		switch video.Type {
+		case "youtube":
+			links = append(links, fmt.Sprintf("[Video %d](https://www.youtube.com/watch?v=%s)", i+1, video.Key))
+		case "tba":
+			links = append(links, fmt.Sprintf("[Video %d](https://www.thebluealliance.com/match/%s)", i+1, m.Key))
+		}
+	}
+	return strings.Join(links, " • ")
+}
+
+func formatUnix(ts int64, loc *time.Location) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.Unix(ts, 0).In(loc).Format("Mon 15:04 MST")
+}
+
+func matchEmbed(m *tbaMatch, loc *time.Location) *discordgo.MessageEmbed {
+	year := 0
+	fmt.Sscanf(m.EventKey, "%4d", &year)
+
+	red, blue := m.Alliances["red"], m.Alliances["blue"]
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("%s %s", m.EventKey, matchName(m)),
+		URL:   "https://www.thebluealliance.com/match/" + m.Key,
+	}
+
+	redScore, blueScore := "-", "-"
+	if m.played() {
+		redScore = fmt.Sprintf("%d", red.Score)
+		blueScore = fmt.Sprintf("%d", blue.Score)
+	}
+	embed.Fields = append(embed.Fields,
+		&discordgo.MessageEmbedField{Name: "Red " + redScore, Value: allianceTeams(red), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Blue " + blueScore, Value: allianceTeams(blue), Inline: true},
+	)
+
+	switch {
+	case !m.played():
+		embed.Description = "Not played yet."
+	case m.WinningAlliance == "red":
+		embed.Color = redColor
+		embed.Description = "**Red wins**"
+	case m.WinningAlliance == "blue":
+		embed.Color = blueColor
+		embed.Description = "**Blue wins**"
+	default:
+		embed.Description = "**Tie**"
+	}
+
+	if table := breakdownTable(m, year); table != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Breakdown", Value: table})
+	}
+
+	embed.Fields = append(embed.Fields,
+		&discordgo.MessageEmbedField{Name: "Scheduled", Value: formatUnix(m.Time, loc), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Predicted", Value: formatUnix(m.PredictedTime, loc), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Actual", Value: formatUnix(m.ActualTime, loc), Inline: true},
+	)
+
+	if links := videoLinks(m); links != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Videos", Value: links})
+	}
+	return embed
+}
+
+func matchCommand(ctx *commandContext) error {
+	key, err := resolveMatchKey(ctx.msg.ChannelID, ctx.str("match"))
+	if err != nil {
+		return err
+	}
+
+	m, err := tbaMatchInfo(key)
+	if err == errTBANotFound {
+		return commandError(fmt.Sprintf("TBA doesn't have a match %s.", key))
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.replyEmbed(matchEmbed(m, ctx.settings.location()))
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "match",
+		aliases: []string{"m"},
+		summary: "Show a match's score, breakdown and videos.",
+		help:    "Use a full key like 2019casj_qm42, or just qm42 or sf1m2 in a channel that follows an event.",
+		args:    []argSpec{{name: "match"}},
+		run:     matchCommand,
+	})
+}
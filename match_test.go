@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveMatchKey(t *testing.T) {
+	// Full keys never look up the channel's followed event.
+	tests := []struct {
+		raw, want string
+	}{
+		{"2019casj_qm42", "2019casj_qm42"},
+		{"2019CASJ_QM42", "2019casj_qm42"},
+		{"2019casj_q7", "2019casj_qm7"},
+		{"2019casj_sf2m3", "2019casj_sf2m3"},
+		{"2019casj_f1", "2019casj_f1m1"},
+		{"2024mrcmp_ef4m2", "2024mrcmp_ef4m2"},
+	}
+	for _, test := range tests {
+		got, err := resolveMatchKey("", test.raw)
+		if err != nil || got != test.want {
+			t.Errorf("resolveMatchKey(%q) = %q, %v, want %q", test.raw, got, err, test.want)
+		}
+	}
+
+	for _, raw := range []string{"", "42", "casj_qm42", "2019casj_qm", "2019casj_xx1", "2019casj_qm42 "} {
+		if _, err := resolveMatchKey("", raw); err == nil {
+			t.Errorf("resolveMatchKey(%q) didn't fail", raw)
+		} else if _, ok := err.(usageError); !ok {
+			t.Errorf("resolveMatchKey(%q) error = %#v, want a usageError", raw, err)
+		}
+	}
+}
+
+func TestMatchKeyRegex(t *testing.T) {
+	match := matchKeyRegex.FindStringSubmatch("qf3m2")
+	if want := []string{"qf3m2", "", "qf", "3", "2"}; !reflect.DeepEqual(match, want) {
+		t.Errorf("FindStringSubmatch(qf3m2) = %q, want %q", match, want)
+	}
+}
+
+func TestMissingBreakdownKeys(t *testing.T) {
+	played := func(red, blue map[string]interface{}) tbaMatch {
+		return tbaMatch{
+			Alliances:      map[string]*tbaMatchAlliance{"red": {Score: 10}, "blue": {Score: 5}},
+			ScoreBreakdown: map[string]map[string]interface{}{"red": red, "blue": blue},
+		}
+	}
+	matches := []tbaMatch{
+		played(map[string]interface{}{"a": 1.0}, map[string]interface{}{"b": true}),
+		played(nil, nil),
+	}
+	if got, want := missingBreakdownKeys(matches, []string{"a", "b", "c"}), []string{"c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missingBreakdownKeys = %v, want %v", got, want)
+	}
+
+	// Without any breakdowns there's nothing to compare against.
+	unplayed := tbaMatch{
+		Alliances:      map[string]*tbaMatchAlliance{"red": {Score: -1}, "blue": {Score: -1}},
+		ScoreBreakdown: map[string]map[string]interface{}{"red": {}, "blue": {}},
+	}
+	if got := missingBreakdownKeys([]tbaMatch{unplayed, played(nil, nil)}, []string{"a"}); got != nil {
+		t.Errorf("missingBreakdownKeys without breakdowns = %v, want nil", got)
+	}
+}
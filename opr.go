@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jlmcmchl/tbc-discord-bot/stats"
+)
+
+const oprsPerPage = 25
+
+// statsAlliance converts one alliance of a TBA match, including the numeric
+// fields of its score breakdown.
+func statsAlliance(m *tbaMatch, color string) stats.Alliance {
+	a := stats.Alliance{
+		Teams:  m.Alliances[color].TeamKeys,
+		Score:  float64(m.Alliances[color].Score),
+		Values: map[string]float64{},
+	}
+	for field, v := range m.ScoreBreakdown[color] {
+		switch value := v.(type) {
+		case float64:
+			a.Values[field] = value
+		case bool:
+			if value {
+				a.Values[field] = 1
+			} else {
+				a.Values[field] = 0
+			}
+		}
+	}
+	return a
+}
+
+// qualMatches returns the played qualification matches of an event in the
+// order they were played, ready for the stats package.
+func qualMatches(matches []tbaMatch) []stats.Match {
+	var quals []*tbaMatch
+	for i := range matches {
+		if matches[i].CompLevel == "qm" && matches[i].played() {
+			quals = append(quals, &matches[i])
+		}
+	}
+	sort.Slice(quals, func(i, j int) bool { return matchLess(quals[i], quals[j]) })
+
+	result := make([]stats.Match, len(quals))
+	for i, m := range quals {
+		result[i] = stats.Match{Red: statsAlliance(m, "red"), Blue: statsAlliance(m, "blue")}
+	}
+	return result
+}
+
+// eventRatings computes OPR, DPR and CCWM for an event's qualification
+// matches, optionally only each team's last n matches.
+func eventRatings(event string, last int) (*stats.Ratings, []stats.Match, error) {
+	matches, err := tbaEventMatches(event)
+	if err = ignoreNotFound(err); err != nil {
+		return nil, nil, err
+	}
+
+	quals := qualMatches(matches)
+	if last > 0 {
+		quals = stats.Last(quals, last)
+	}
+
+	ratings, err := stats.Compute(quals)
+	if err == stats.ErrNoMatches {
+		return nil, nil, commandError(fmt.Sprintf("%s doesn't have any played qualification matches yet.", event))
+	}
+	return ratings, quals, err
+}
+
+func oprCommand(ctx *commandContext) error {
+	event := ctx.str("event")
+	last := ctx.num("last")
+	if ctx.has("last") && last < 1 {
+		return commandError("--last must be at least 1.")
+	}
+
+	ratings, quals, err := eventRatings(event, last)
+	if err != nil {
+		return err
+	}
+
+	title := event + " OPR"
+	if last > 0 {
+		title += fmt.Sprintf(" (last %d matches)", last)
+	}
+
+	var rows []string
+	teams := append([]string{}, ratings.Teams...)
+	values := ratings.OPR
+	if ctx.has("component") {
+		field := ctx.str("component")
+		fields := stats.Fields(quals)
+		found := false
+		for _, f := range fields {
+			if strings.EqualFold(f, field) {
+				field, found = f, true
+			}
+		}
+		if !found {
+			return commandError(fmt.Sprintf("%s isn't a numeric breakdown field at %s. Try one of: %s",
+				field, event, truncate(strings.Join(fields, ", "), 1500)))
+		}
+
+		component, err := stats.Component(quals, field)
+		if err != nil {
+			return err
+		}
+		values = component
+		sort.Slice(teams, func(i, j int) bool { return component[teams[i]] > component[teams[j]] })
+		title = fmt.Sprintf("%s %s OPR", event, field)
+		if last > 0 {
+			title += fmt.Sprintf(" (last %d matches)", last)
+		}
+
+		for i, team := range teams {
+			rows = append(rows, fmt.Sprintf("%4d %-6s %7.2f", i+1, strings.TrimPrefix(team, "frc"), component[team]))
+		}
+		rows = append([]string{fmt.Sprintf("%4s %-6s %7s", "#", "Team", field)}, rows...)
+	} else {
+		sort.Slice(teams, func(i, j int) bool { return ratings.OPR[teams[i]] > ratings.OPR[teams[j]] })
+		for i, team := range teams {
+			rows = append(rows, fmt.Sprintf("%4d %-6s %7.2f %7.2f %7.2f", i+1, strings.TrimPrefix(team, "frc"),
+				ratings.OPR[team], ratings.DPR[team], ratings.CCWM[team]))
+		}
+		rows = append([]string{fmt.Sprintf("%4s %-6s %7s %7s %7s", "#", "Team", "OPR", "DPR", "CCWM")}, rows...)
+	}
+
+	if ctx.flag("chart") {
+		image, err := barChart(title, teams, values)
+		if err != nil {
+			return err
+		}
+		_, err = ctx.replyChart(event+"-opr.png", image)
+		return err
+	}
+
+	header, rows := rows[0], rows[1:]
+	var pages []*discordgo.MessageEmbed
+	for start := 0; start < len(rows); start += oprsPerPage {
+		end := start + oprsPerPage
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "```\n%s\n%s\n```", header, strings.Join(rows[start:end], "\n"))
+		pages = append(pages, &discordgo.MessageEmbed{
+			Title:       title,
+			URL:         "https://www.thebluealliance.com/event/" + event + "#event-insights",
+			Color:       tbaColor,
+			Description: buf.String(),
+			Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d qualification matches", len(quals))},
+		})
+	}
+
+	_, err = ctx.replyPages(pages)
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "opr",
+		summary: "Compute OPR, DPR and CCWM for an event from its qualification matches.",
+		help:    "Give a score breakdown field such as autoPoints to get that component's OPR instead. Use --chart for a bar chart.",
+		args: []argSpec{
+			{name: "event", kind: argEvent},
+			{name: "component", optional: true},
+		},
+		flags: []argSpec{{name: "last", kind: argInt}, {name: "chart", kind: argBool}},
+		run:   oprCommand,
+	})
+}
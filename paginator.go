@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	pagePrev = "◀"
+	pageNext = "▶"
+
+	// paginatorTTL is how long reactions keep working on a paged message.
+	paginatorTTL = 30 * time.Minute
+)
+
+// paginator is a message whose embed can be flipped through with reactions.
+type paginator struct {
+	channelID string
+	pages     []*discordgo.MessageEmbed
+	page      int
+	expires   time.Time
+}
+
+var (
+	paginators     = map[string]*paginator{}
+	paginatorMutex = &sync.Mutex{}
+)
+
+// sendPages posts the first page and, if there is more than one, adds the
+// reactions used to move between pages. Each page gets a "Page x/y" footer.
+func sendPages(dg *discordgo.Session, channelID string, pages []*discordgo.MessageEmbed) (*discordgo.Message, error) {
+	for i, page := range pages {
+		if len(pages) == 1 {
+			break
+		}
+		text := fmt.Sprintf("Page %d/%d", i+1, len(pages))
+		if page.Footer != nil && page.Footer.Text != "" {
+			text = page.Footer.Text + " • " + text
+		}
+		page.Footer = &discordgo.MessageEmbedFooter{Text: text}
+	}
+
+	msg, err := dg.ChannelMessageSendEmbed(channelID, pages[0])
+	if err != nil || len(pages) == 1 {
+		return msg, err
+	}
+
+	paginatorMutex.Lock()
+	for id, p := range paginators {
+		if time.Now().After(p.expires) {
+			delete(paginators, id)
+		}
+	}
+	paginators[msg.ID] = &paginator{
+		channelID: channelID,
+		pages:     pages,
+		expires:   time.Now().Add(paginatorTTL),
+	}
+	paginatorMutex.Unlock()
+
+	for _, emoji := range []string{pagePrev, pageNext} {
+		if err = dg.MessageReactionAdd(channelID, msg.ID, emoji); err != nil {
+			log.Println(err)
+		}
+	}
+	return msg, nil
+}
+
+func (ctx *commandContext) replyPages(pages []*discordgo.MessageEmbed) (*discordgo.Message, error) {
+	return sendPages(ctx.dg, ctx.msg.ChannelID, pages)
+}
+
+func paginatorReaction(dg *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r.UserID == dg.State.User.ID || (r.Emoji.Name != pagePrev && r.Emoji.Name != pageNext) {
+		return
+	}
+
+	paginatorMutex.Lock()
+	p, ok := paginators[r.MessageID]
+	if !ok || time.Now().After(p.expires) {
+		paginatorMutex.Unlock()
+		return
+	}
+
+	if r.Emoji.Name == pageNext {
+		p.page = (p.page + 1) % len(p.pages)
+	} else {
+		p.page = (p.page + len(p.pages) - 1) % len(p.pages)
+	}
+	page := p.pages[p.page]
+	paginatorMutex.Unlock()
+
+	if _, err := dg.ChannelMessageEditEmbed(r.ChannelID, r.MessageID, page); err != nil {
+		log.Println(err)
+	}
+	if err := dg.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.Name, r.UserID); err != nil {
+		log.Println(err)
+	}
+}
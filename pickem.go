@@ -0,0 +1,558 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	pickRed  = "🔴"
+	pickBlue = "🔵"
+
+	// pickemLead is how long before a match's scheduled start it is posted.
+	pickemLead      = 2 * time.Hour
+	pickemStandings = 15
+)
+
+var (
+	// pickemMutex guards picks while reactions are reconciled.
+	pickemMutex = &sync.Mutex{}
+	// pickemUpdateMutex keeps the cron job and a newly started game from
+	// both seeing a match as unposted and posting it twice.
+	pickemUpdateMutex = &sync.Mutex{}
+)
+
+// pickemMatch is a match posted for picks in a channel.
+type pickemMatch struct {
+	Channel  string
+	MatchKey string
+	Guild    string
+	Event    string
+	Msg      string
+	StartAt  time.Time
+	Locked   bool
+	Result   sql.NullString
+}
+
+const selectPickem = "SELECT Channel, Match_Key, Guild, Event, Msg, Start_At, Locked, Result FROM Pickem_Matches"
+
+func scanPickem(row interface {
+	Scan(dest ...interface{}) error
+}) (*pickemMatch, error) {
+	var pm pickemMatch
+	err := row.Scan(&pm.Channel, &pm.MatchKey, &pm.Guild, &pm.Event, &pm.Msg, &pm.StartAt, &pm.Locked, &pm.Result)
+	if err != nil {
+		return nil, err
+	}
+	return &pm, nil
+}
+
+// closed reports whether picks can no longer change. The cron job only locks
+// matches every few minutes, so the start time is checked as well.
+func (pm *pickemMatch) closed() bool {
+	return pm.Locked || !time.Now().Before(pm.StartAt)
+}
+
+func pickColor(emoji discordgo.Emoji) string {
+	switch emoji.Name {
+	case pickRed:
+		return "red"
+	case pickBlue:
+		return "blue"
+	}
+	return ""
+}
+
+func pickEmoji(color string) string {
+	if color == "red" {
+		return pickRed
+	}
+	return pickBlue
+}
+
+// pickemFor returns the posted match for a message, or nil.
+func pickemFor(messageID string) *pickemMatch {
+	pm, err := scanPickem(db.QueryRow(selectPickem+" WHERE Msg = $1", messageID))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return pm
+}
+
+// pickCounts returns how many members picked red and blue.
+func pickCounts(pm *pickemMatch) (red, blue int, err error) {
+	err = db.QueryRow(`SELECT COUNT(*) FILTER (WHERE Pick = 'red'), COUNT(*) FILTER (WHERE Pick = 'blue')
+		FROM Pickem_Picks WHERE Channel = $1 AND Match_Key = $2`, pm.Channel, pm.MatchKey).Scan(&red, &blue)
+	return red, blue, err
+}
+
+func pickemEmbed(m *tbaMatch, pm *pickemMatch, loc *time.Location) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Pick'em: %s %s", m.EventKey, matchName(m)),
+		URL:   "https://www.thebluealliance.com/match/" + m.Key,
+		Color: tbaColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: pickRed + " Red", Value: allianceTeams(m.Alliances["red"]), Inline: true},
+			{Name: pickBlue + " Blue", Value: allianceTeams(m.Alliances["blue"]), Inline: true},
+		},
+	}
+
+	if !pm.Locked {
+		embed.Description = fmt.Sprintf("React with %s or %s to pick the winner. Picks lock at %s.",
+			pickRed, pickBlue, pm.StartAt.In(loc).Format("Mon 15:04 MST"))
+		return embed
+	}
+
+	red, blue, err := pickCounts(pm)
+	if err != nil {
+		log.Println(err)
+	}
+	picks := fmt.Sprintf("%d picked red, %d picked blue.", red, blue)
+
+	switch pm.Result.String {
+	case "":
+		embed.Description = "Picks are locked. " + picks
+	case "red", "blue":
+		if pm.Result.String == "red" {
+			embed.Color = redColor
+		} else {
+			embed.Color = blueColor
+		}
+		embed.Description = fmt.Sprintf("**%s wins %d-%d.** %s", strings.Title(pm.Result.String),
+			m.Alliances[pm.Result.String].Score, m.Alliances[opponent(pm.Result.String)].Score, picks)
+	default:
+		embed.Description = fmt.Sprintf("**Tie %d-%d**, nobody scores. %s", m.Alliances["red"].Score, m.Alliances["blue"].Score, picks)
+	}
+	return embed
+}
+
+// postPickem posts a match for picks and seeds the two reactions.
+func postPickem(dg *discordgo.Session, channel, guild, event string, m *tbaMatch) error {
+	pm := &pickemMatch{Channel: channel, MatchKey: m.Key, Guild: guild, Event: event, StartAt: time.Unix(m.Time, 0)}
+
+	msg, err := dg.ChannelMessageSendEmbed(channel, pickemEmbed(m, pm, guildSettingsFor(guild).location()))
+	if err != nil {
+		return err
+	}
+	for _, emoji := range []string{pickRed, pickBlue} {
+		if err = dg.MessageReactionAdd(channel, msg.ID, emoji); err != nil {
+			log.Println(err)
+		}
+	}
+
+	_, err = db.Exec(`INSERT INTO Pickem_Matches (Channel, Match_Key, Guild, Event, Msg, Start_At) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING`, channel, m.Key, guild, event, msg.ID, pm.StartAt)
+	return err
+}
+
+// lockPickem reconciles picks with the reactions on the message, in case
+// reactions changed while the bot was offline, and locks the match.
+func lockPickem(dg *discordgo.Session, pm *pickemMatch, m *tbaMatch) error {
+	pickemMutex.Lock()
+	defer pickemMutex.Unlock()
+
+	reacted := map[string][]string{}
+	for _, color := range []string{"red", "blue"} {
+		users, err := reactionUsers(dg, pm.Channel, pm.Msg, pickEmoji(color))
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if !user.Bot {
+				reacted[user.ID] = append(reacted[user.ID], color)
+			}
+		}
+	}
+
+	rows, err := db.Query("SELECT Member, Pick FROM Pickem_Picks WHERE Channel = $1 AND Match_Key = $2", pm.Channel, pm.MatchKey)
+	if err != nil {
+		return err
+	}
+	picks := map[string]string{}
+	for rows.Next() {
+		var member, pick string
+		if err = rows.Scan(&member, &pick); err != nil {
+			rows.Close()
+			return err
+		}
+		picks[member] = pick
+	}
+	rows.Close()
+
+	for member, pick := range picks {
+		kept := false
+		for _, color := range reacted[member] {
+			kept = kept || color == pick
+		}
+		if !kept {
+			if _, err = db.Exec("DELETE FROM Pickem_Picks WHERE Channel = $1 AND Match_Key = $2 AND Member = $3",
+				pm.Channel, pm.MatchKey, member); err != nil {
+				return err
+			}
+		}
+	}
+	for member, colors := range reacted {
+		if _, ok := picks[member]; ok || len(colors) != 1 {
+			continue
+		}
+		if _, err = db.Exec("INSERT INTO Pickem_Picks (Channel, Match_Key, Member, Pick, Picked_At) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING",
+			pm.Channel, pm.MatchKey, member, colors[0], pm.StartAt); err != nil {
+			return err
+		}
+	}
+
+	if _, err = db.Exec("UPDATE Pickem_Matches SET Locked = TRUE WHERE Channel = $1 AND Match_Key = $2", pm.Channel, pm.MatchKey); err != nil {
+		return err
+	}
+	pm.Locked = true
+
+	_, err = dg.ChannelMessageEditEmbed(pm.Channel, pm.Msg, pickemEmbed(m, pm, guildSettingsFor(pm.Guild).location()))
+	return err
+}
+
+// scorePickem records a played match's result and marks every pick.
+func scorePickem(dg *discordgo.Session, pm *pickemMatch, m *tbaMatch) error {
+	result := m.WinningAlliance
+	if result == "" {
+		result = "tie"
+	}
+
+	_, err := db.Exec("UPDATE Pickem_Picks SET Correct = (Pick = $1) WHERE Channel = $2 AND Match_Key = $3", result, pm.Channel, pm.MatchKey)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("UPDATE Pickem_Matches SET Result = $1 WHERE Channel = $2 AND Match_Key = $3", result, pm.Channel, pm.MatchKey)
+	if err != nil {
+		return err
+	}
+	pm.Result = sql.NullString{String: result, Valid: true}
+
+	_, err = dg.ChannelMessageEditEmbed(pm.Channel, pm.Msg, pickemEmbed(m, pm, guildSettingsFor(pm.Guild).location()))
+	return err
+}
+
+// postUpcomingPickems posts every match of the channels' pick'em events that
+// starts within pickemLead.
+func postUpcomingPickems(dg *discordgo.Session) error {
+	rows, err := db.Query("SELECT Channel, Guild, Target FROM Follows WHERE Kind = $1", followPickem)
+	if err != nil {
+		return err
+	}
+	type game struct{ channel, guild, event string }
+	var games []game
+	for rows.Next() {
+		var g game
+		if err = rows.Scan(&g.channel, &g.guild, &g.event); err != nil {
+			rows.Close()
+			return err
+		}
+		games = append(games, g)
+	}
+	rows.Close()
+
+	now := time.Now()
+	for _, g := range games {
+		matches, err := tbaEventMatches(g.event)
+		if err = ignoreNotFound(err); err != nil {
+			log.Println(err)
+			continue
+		}
+
+		for i := range matches {
+			m := &matches[i]
+			start := time.Unix(m.Time, 0)
+			if m.Time == 0 || m.played() || !start.After(now) || start.Sub(now) > pickemLead {
+				continue
+			}
+			if m.Alliances["red"] == nil || m.Alliances["blue"] == nil || len(m.Alliances["red"].TeamKeys) == 0 {
+				continue
+			}
+
+			var posted bool
+			err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM Pickem_Matches WHERE Channel = $1 AND Match_Key = $2)",
+				g.channel, m.Key).Scan(&posted)
+			if err != nil {
+				return err
+			}
+			if !posted {
+				if err = postPickem(dg, g.channel, g.guild, g.event, m); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// updatePickem posts upcoming matches, locks the ones that have started and
+// scores the ones with results.
+func updatePickem() {
+	if session == nil {
+		return
+	}
+	pickemUpdateMutex.Lock()
+	defer pickemUpdateMutex.Unlock()
+
+	if err := postUpcomingPickems(session); err != nil {
+		log.Println(err)
+	}
+
+	rows, err := db.Query(selectPickem + " WHERE Result IS NULL")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	var open []*pickemMatch
+	for rows.Next() {
+		pm, err := scanPickem(rows)
+		if err != nil {
+			log.Println(err)
+			break
+		}
+		open = append(open, pm)
+	}
+	rows.Close()
+
+	events := map[string]map[string]*tbaMatch{}
+	for _, pm := range open {
+		if _, ok := events[pm.Event]; !ok {
+			matches, err := tbaEventMatches(pm.Event)
+			if err = ignoreNotFound(err); err != nil {
+				log.Println(err)
+				continue
+			}
+			events[pm.Event] = map[string]*tbaMatch{}
+			for i := range matches {
+				events[pm.Event][matches[i].Key] = &matches[i]
+			}
+		}
+
+		m := events[pm.Event][pm.MatchKey]
+		if m == nil {
+			continue
+		}
+		if !pm.Locked && pm.closed() {
+			if err = lockPickem(session, pm, m); err != nil {
+				log.Println(err)
+				continue
+			}
+		}
+		if pm.Locked && m.played() {
+			if err = scorePickem(session, pm, m); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+func pickemAdded(dg *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r.UserID == dg.State.User.ID {
+		return
+	}
+
+	color := pickColor(r.Emoji)
+	if color == "" {
+		return
+	}
+	pm := pickemFor(r.MessageID)
+	if pm == nil {
+		return
+	}
+	if pm.closed() {
+		if err := dg.MessageReactionRemove(r.ChannelID, r.MessageID, r.Emoji.Name, r.UserID); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	pickemMutex.Lock()
+	defer pickemMutex.Unlock()
+
+	var previous string
+	err := db.QueryRow("SELECT Pick FROM Pickem_Picks WHERE Channel = $1 AND Match_Key = $2 AND Member = $3",
+		pm.Channel, pm.MatchKey, r.UserID).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+		return
+	}
+
+	_, err = db.Exec(`INSERT INTO Pickem_Picks (Channel, Match_Key, Member, Pick, Picked_At) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (Channel, Match_Key, Member) DO UPDATE SET Pick = $4, Picked_At = $5`,
+		pm.Channel, pm.MatchKey, r.UserID, color, time.Now())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Switching sides takes away the old reaction. Its removal event finds the
+	// new pick stored and leaves it alone.
+	if previous != "" && previous != color {
+		if err = dg.MessageReactionRemove(r.ChannelID, r.MessageID, pickEmoji(previous), r.UserID); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func pickemRemoved(dg *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	if r.UserID == dg.State.User.ID {
+		return
+	}
+
+	color := pickColor(r.Emoji)
+	if color == "" {
+		return
+	}
+	pm := pickemFor(r.MessageID)
+	if pm == nil || pm.closed() {
+		return
+	}
+
+	pickemMutex.Lock()
+	defer pickemMutex.Unlock()
+
+	_, err := db.Exec("DELETE FROM Pickem_Picks WHERE Channel = $1 AND Match_Key = $2 AND Member = $3 AND Pick = $4",
+		pm.Channel, pm.MatchKey, r.UserID, color)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// pickemLeaders returns the guild's standings for matches starting at or
+// after since.
+func pickemLeaders(guild string, since time.Time) (string, error) {
+	rows, err := db.Query(`SELECT p.Member, COUNT(*) FILTER (WHERE p.Correct), COUNT(*)
+		FROM Pickem_Picks p JOIN Pickem_Matches m ON m.Channel = p.Channel AND m.Match_Key = p.Match_Key
+		WHERE m.Guild = $1 AND m.Result IS NOT NULL AND m.Start_At >= $2
+		GROUP BY p.Member ORDER BY 2 DESC, 3 ASC LIMIT $3`, guild, since, pickemStandings)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var member string
+		var correct, picks int
+		if err = rows.Scan(&member, &correct, &picks); err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("%d. <@%s> **%d**/%d", len(lines)+1, member, correct, picks))
+	}
+	if len(lines) == 0 {
+		return "No scored picks yet", rows.Err()
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
+
+func pickemStandingsEmbed(ctx *commandContext) (*discordgo.MessageEmbed, error) {
+	now := time.Now().In(ctx.settings.location())
+	day := now.AddDate(0, 0, -(int(now.Weekday())+6)%7)
+	week := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, now.Location())
+	season := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+
+	weekly, err := pickemLeaders(ctx.guild, week)
+	if err != nil {
+		return nil, err
+	}
+	seasonal, err := pickemLeaders(ctx.guild, season)
+	if err != nil {
+		return nil, err
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: "Pick'em standings",
+		Color: tbaColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "This week", Value: weekly, Inline: true},
+			{Name: fmt.Sprintf("%d season", now.Year()), Value: seasonal, Inline: true},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: "Correct picks / total picks. Weeks start on Monday."},
+	}, nil
+}
+
+func pickemCommand(ctx *commandContext) error {
+	if ctx.guild == "" {
+		return commandError("Pick'em only runs in servers.")
+	}
+
+	action := strings.ToLower(ctx.str("action"))
+	switch action {
+	case "standings", "leaderboard":
+		embed, err := pickemStandingsEmbed(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = ctx.replyEmbed(embed)
+		return err
+
+	case "start", "stop":
+		if !isAdmin(ctx.dg, ctx.msg) {
+			return commandError("Only server admins can start or stop pick'em.")
+		}
+		if !ctx.has("event") {
+			return usageError("give the event, like 2019casj")
+		}
+		event := ctx.str("event")
+
+		if action == "stop" {
+			res, err := db.Exec("DELETE FROM Follows WHERE Channel = $1 AND Kind = $2 AND Target = $3",
+				ctx.msg.ChannelID, followPickem, event)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err == nil && n == 0 {
+				return commandError(fmt.Sprintf("This channel isn't running pick'em for %s.", event))
+			}
+			_, err = ctx.reply(fmt.Sprintf("Stopped pick'em for %s. Matches already posted will still be scored.", event))
+			return err
+		}
+
+		e, err := tbaEventInfo(event)
+		if err == errTBANotFound {
+			return commandError(fmt.Sprintf("TBA doesn't know about %s.", event))
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`INSERT INTO Follows (Channel, Guild, Kind, Target, Created_At) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (Channel, Kind, Target) DO NOTHING`,
+			ctx.msg.ChannelID, ctx.guild, followPickem, event, time.Now())
+		if err != nil {
+			return err
+		}
+
+		_, err = ctx.reply(fmt.Sprintf("Pick'em is on for **%d %s**. Matches are posted here %d minutes before they're scheduled to start.",
+			e.Year, e.Name, int(pickemLead.Minutes())))
+		if err == nil {
+			go updatePickem()
+		}
+		return err
+	}
+
+	return usageError(fmt.Sprintf("unknown action %q", ctx.str("action")))
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "pickem",
+		summary: "Pick the winners of upcoming matches.",
+		help: "`pickem start 2019casj` posts that event's matches in this channel for picks (admins only), " +
+			"`pickem stop 2019casj` ends it and `pickem standings` shows the weekly and season leaderboards.",
+		args: []argSpec{
+			{name: "action"},
+			{name: "event", kind: argEvent, optional: true},
+		},
+		run: pickemCommand,
+	})
+}
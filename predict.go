@@ -0,0 +1,402 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jlmcmchl/tbc-discord-bot/stats"
+)
+
+// minPriorMatches is how many qualification matches every team in a match
+// must have played before the backtest trusts OPR for it.
+const minPriorMatches = 2
+
+var (
+	versusRegex   = regexp.MustCompile(`(?i)\s+vs?\.?\s+`)
+	teamListRegex = regexp.MustCompile(`[,\s]+`)
+)
+
+// prediction is the output of the bot's models for one red vs blue matchup.
+type prediction struct {
+	red, blue           []string
+	eloRed, eloBlue     float64
+	eloProb             float64
+	haveScores          bool
+	scoreRed, scoreBlue float64
+	scoreProb           float64
+}
+
+// probability blends the Elo and OPR based win probabilities for red.
+func (p *prediction) probability() float64 {
+	if !p.haveScores {
+		return p.eloProb
+	}
+	return (p.eloProb + p.scoreProb) / 2
+}
+
+// scoreModel projects alliance scores from OPR. Teams can come from
+// different events, each with its own ratings.
+type scoreModel struct {
+	oprs   map[string]float64
+	sigmas []float64
+}
+
+func (s *scoreModel) add(r *stats.Ratings, matches []stats.Match, teams []string) {
+	for _, team := range teams {
+		if opr, ok := r.OPR[team]; ok {
+			s.oprs[team] = opr
+		}
+	}
+	s.sigmas = append(s.sigmas, r.Sigma(matches))
+}
+
+func (s *scoreModel) score(teams []string) (float64, bool) {
+	sum := 0.0
+	for _, team := range teams {
+		opr, ok := s.oprs[team]
+		if !ok {
+			return 0, false
+		}
+		sum += opr
+	}
+	return sum, true
+}
+
+func (s *scoreModel) sigma() float64 {
+	if len(s.sigmas) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, sigma := range s.sigmas {
+		sum += sigma
+	}
+	return sum / float64(len(s.sigmas))
+}
+
+func predict(elo *stats.Elo, scores *scoreModel, red, blue []string) *prediction {
+	p := &prediction{
+		red:     red,
+		blue:    blue,
+		eloRed:  elo.AllianceRating(red),
+		eloBlue: elo.AllianceRating(blue),
+		eloProb: elo.WinProbability(red, blue),
+	}
+
+	if scores == nil {
+		return p
+	}
+	redScore, redOK := scores.score(red)
+	blueScore, blueOK := scores.score(blue)
+	if redOK && blueOK {
+		p.haveScores = true
+		p.scoreRed, p.scoreBlue = redScore, blueScore
+		p.scoreProb = stats.MarginProbability(redScore-blueScore, scores.sigma())
+	}
+	return p
+}
+
+// currentElo copies the live ratings so callers don't hold the lock.
+func currentElo() *stats.Elo {
+	eloMutex.Lock()
+	defer eloMutex.Unlock()
+
+	return eloModel.Copy()
+}
+
+// eloBefore rebuilds what the teams' ratings were before a point in time, for
+// backtesting an event without peeking at later results.
+func eloBefore(teams []string, before time.Time, year int) (*stats.Elo, error) {
+	elo := stats.NewElo()
+	for _, team := range teams {
+		var rating float64
+		var ratedYear int
+		err := db.QueryRow("SELECT Rating, Year FROM Elo_History WHERE Team = $1 AND Played_At < $2 ORDER BY Played_At DESC LIMIT 1",
+			team, before).Scan(&rating, &ratedYear)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if ratedYear < year {
+			rating -= elo.Regression * (rating - elo.Mean)
+		}
+		elo.Ratings[team] = rating
+	}
+	return elo, nil
+}
+
+func parseTeamList(raw string) ([]string, error) {
+	var teams []string
+	for _, field := range teamListRegex.Split(strings.TrimSpace(raw), -1) {
+		if field == "" {
+			continue
+		}
+		team, err := convertArg(argSpec{name: "team", kind: argTeam}, field)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, teamKey(team.(string)))
+	}
+	return teams, nil
+}
+
+func predictionEmbed(title, url string, p *prediction) *discordgo.MessageEmbed {
+	prob := p.probability()
+	embed := &discordgo.MessageEmbed{
+		Title: title,
+		URL:   url,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Red", Value: teamList(p.red) + fmt.Sprintf("\nElo %.0f", p.eloRed), Inline: true},
+			{Name: "Blue", Value: teamList(p.blue) + fmt.Sprintf("\nElo %.0f", p.eloBlue), Inline: true},
+			{Name: "Win probability", Value: fmt.Sprintf("Red %.0f%% • Blue %.0f%%", 100*prob, 100*(1-prob))},
+		},
+	}
+
+	if prob >= 0.5 {
+		embed.Color = redColor
+	} else {
+		embed.Color = blueColor
+	}
+
+	models := fmt.Sprintf("Elo: red %.0f%%", 100*p.eloProb)
+	if p.haveScores {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Projected score",
+			Value: fmt.Sprintf("Red %.0f - %.0f Blue", p.scoreRed, p.scoreBlue),
+		})
+		models += fmt.Sprintf(" • OPR: red %.0f%%", 100*p.scoreProb)
+	} else {
+		models += " • OPR: not enough matches"
+	}
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: models}
+	return embed
+}
+
+func predictMatch(ctx *commandContext, raw string) error {
+	key, err := resolveMatchKey(ctx.msg.ChannelID, raw)
+	if err != nil {
+		return err
+	}
+
+	m, err := tbaMatchInfo(key)
+	if err == errTBANotFound {
+		return commandError(fmt.Sprintf("TBA doesn't have a match %s.", key))
+	}
+	if err != nil {
+		return err
+	}
+
+	matches, err := tbaEventMatches(m.EventKey)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	var others []tbaMatch
+	for _, other := range matches {
+		if other.Key != m.Key {
+			others = append(others, other)
+		}
+	}
+
+	red, blue := m.Alliances["red"].TeamKeys, m.Alliances["blue"].TeamKeys
+	var scores *scoreModel
+	quals := qualMatches(others)
+	if ratings, err := stats.Compute(quals); err == nil {
+		scores = &scoreModel{oprs: map[string]float64{}}
+		scores.add(ratings, quals, append(append([]string{}, red...), blue...))
+	}
+
+	p := predict(currentElo(), scores, red, blue)
+	embed := predictionEmbed(fmt.Sprintf("%s %s", m.EventKey, matchName(m)), "https://www.thebluealliance.com/match/"+m.Key, p)
+	if m.played() {
+		embed.Description = fmt.Sprintf("Actual: Red %d - %d Blue", m.Alliances["red"].Score, m.Alliances["blue"].Score)
+	}
+
+	_, err = ctx.replyEmbed(embed)
+	return err
+}
+
+func predictTeams(ctx *commandContext, redRaw, blueRaw string) error {
+	red, err := parseTeamList(redRaw)
+	if err != nil {
+		return err
+	}
+	blue, err := parseTeamList(blueRaw)
+	if err != nil {
+		return err
+	}
+	for _, alliance := range [][]string{red, blue} {
+		if len(alliance) == 0 || len(alliance) > 4 {
+			return usageError("each alliance needs 1 to 4 teams")
+		}
+	}
+
+	// Each team's OPR comes from the given event, or else its current event.
+	teams := append(append([]string{}, red...), blue...)
+	events := map[string][]string{}
+	if ctx.has("event") {
+		events[ctx.str("event")] = teams
+	} else {
+		year := time.Now().Year()
+		for _, key := range teams {
+			code, _ := determineEvent(strings.TrimPrefix(key, "frc"), year)
+			if code != "" {
+				event := fmt.Sprintf("%d%s", year, code)
+				events[event] = append(events[event], key)
+			}
+		}
+	}
+
+	scores := &scoreModel{oprs: map[string]float64{}}
+	for event, eventTeams := range events {
+		ratings, quals, err := eventRatings(event, 0)
+		if _, ok := err.(commandError); ok {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		scores.add(ratings, quals, eventTeams)
+	}
+
+	p := predict(currentElo(), scores, red, blue)
+	_, err = ctx.replyEmbed(predictionEmbed(teamList(red)+" vs "+teamList(blue), "", p))
+	return err
+}
+
+// backtestEvent replays a completed event, predicting each match with only
+// what was known before it, and scores the predictions.
+func backtestEvent(ctx *commandContext, event string) error {
+	e, err := tbaEventInfo(event)
+	if err == errTBANotFound {
+		return commandError(fmt.Sprintf("TBA doesn't know about %s.", event))
+	}
+	if err != nil {
+		return err
+	}
+
+	all, err := tbaEventMatches(event)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+
+	var matches []*tbaMatch
+	teamSet := map[string]bool{}
+	for i := range all {
+		if all[i].played() {
+			matches = append(matches, &all[i])
+			for _, key := range all[i].Alliances["red"].TeamKeys {
+				teamSet[key] = true
+			}
+			for _, key := range all[i].Alliances["blue"].TeamKeys {
+				teamSet[key] = true
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return commandError(fmt.Sprintf("%s doesn't have any played matches to backtest.", event))
+	}
+	sort.Slice(matches, func(i, j int) bool { return matchLess(matches[i], matches[j]) })
+
+	var teams []string
+	for team := range teamSet {
+		teams = append(teams, team)
+	}
+	start, _ := e.dates()
+	elo, err := eloBefore(teams, start, e.Year)
+	if err != nil {
+		return err
+	}
+
+	var eloTest, oprTest, blendTest stats.Backtest
+	var prior []stats.Match
+	played := map[string]int{}
+	for _, m := range matches {
+		sm := stats.Match{Red: statsAlliance(m, "red"), Blue: statsAlliance(m, "blue")}
+
+		var scores *scoreModel
+		ready := true
+		for _, team := range append(append([]string{}, sm.Red.Teams...), sm.Blue.Teams...) {
+			if played[team] < minPriorMatches {
+				ready = false
+			}
+		}
+		if ready {
+			if ratings, err := stats.Compute(prior); err == nil {
+				scores = &scoreModel{oprs: ratings.OPR, sigmas: []float64{ratings.Sigma(prior)}}
+			}
+		}
+
+		p := predict(elo, scores, sm.Red.Teams, sm.Blue.Teams)
+		result := sm.Result()
+		eloTest.Add(p.eloProb, result)
+		blendTest.Add(p.probability(), result)
+		if p.haveScores {
+			oprTest.Add(p.scoreProb, result)
+		}
+
+		elo.Update(sm, m.CompLevel != "qm")
+		if m.CompLevel == "qm" {
+			prior = append(prior, sm)
+			for _, team := range append(append([]string{}, sm.Red.Teams...), sm.Blue.Teams...) {
+				played[team]++
+			}
+		}
+	}
+
+	line := func(b *stats.Backtest) string {
+		if b.Matches == 0 {
+			return "no matches"
+		}
+		return fmt.Sprintf("Brier %.3f • accuracy %.1f%% • %d matches", b.Brier(), 100*b.Accuracy(), b.Matches)
+	}
+
+	_, err = ctx.replyEmbed(&discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Backtest of %d %s", e.Year, e.Name),
+		URL:         "https://www.thebluealliance.com/event/" + event,
+		Color:       tbaColor,
+		Description: "Each match is predicted using only results from before it. A Brier score of 0.25 is a coin flip, lower is better.",
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Elo", Value: line(&eloTest)},
+			{Name: "OPR", Value: line(&oprTest)},
+			{Name: "Combined", Value: line(&blendTest)},
+		},
+	})
+	return err
+}
+
+func predictCommand(ctx *commandContext) error {
+	raw := ctx.str("matchup")
+
+	if ctx.flag("backtest") {
+		event, err := convertArg(argSpec{name: "event", kind: argEvent}, strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		return backtestEvent(ctx, event.(string))
+	}
+
+	if sides := versusRegex.Split(raw, -1); len(sides) == 2 {
+		return predictTeams(ctx, sides[0], sides[1])
+	}
+	return predictMatch(ctx, raw)
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "predict",
+		aliases: []string{"p"},
+		summary: "Predict a match with the bot's Elo and OPR models.",
+		help: "`predict 2019casj_sf1m1` predicts a scheduled match, `predict 254,1678,971 vs 118,148,2056` any matchup " +
+			"and `predict 2019casj --backtest` scores the models over a completed event.",
+		args:  []argSpec{{name: "matchup", kind: argText}},
+		flags: []argSpec{{name: "event", kind: argEvent}, {name: "backtest", kind: argBool}},
+		run:   predictCommand,
+	})
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jlmcmchl/tbc-discord-bot/stats"
+)
+
+const (
+	projectionRuns    = 10000
+	projectionLimit   = 3 * time.Second
+	projectionsByPage = 20
+	allianceCount     = 8
+)
+
+// rpRule is how a season awards qualification ranking points. Bonus RPs are
+// booleans in each alliance's score breakdown.
+type rpRule struct {
+	win, tie float64
+	bonuses  []string
+}
+
+var rpRules = map[int]rpRule{
+	2018: {2, 1, []string{"autoQuestRankingPoint", "faceTheBossRankingPoint"}},
+	2019: {2, 1, []string{"completeRocketRankingPoint", "habDockingRankingPoint"}},
+	2020: {2, 1, []string{"shieldOperationalRankingPoint", "shieldEnergizedRankingPoint"}},
+	2022: {2, 1, []string{"cargoBonusRankingPoint", "hangarBonusRankingPoint"}},
+	2023: {2, 1, []string{"sustainabilityBonusAchieved", "activationBonusAchieved"}},
+	2024: {2, 1, []string{"melodyBonusAchieved", "ensembleBonusAchieved"}},
+	2025: {3, 1, []string{"autoBonusAchieved", "coralBonusAchieved", "bargeBonusAchieved"}},
+	2026: {3, 1, []string{"energizedAchieved", "superchargedAchieved", "traversalAchieved"}},
+}
+
+// rpRuleFor looks up a season's ranking point rules, with an error for the
+// user when there aren't any rather than guessing.
+func rpRuleFor(year int) (rpRule, error) {
+	rule, ok := rpRules[year]
+	if !ok {
+		return rule, commandError(fmt.Sprintf("I don't know the %d ranking point rules.", year))
+	}
+	return rule, nil
+}
+
+// logMissing logs the ranking point keys that none of an event's played
+// qualification matches have in their score breakdowns. Keys for a new
+// season are written before TBA publishes its breakdowns, and a wrong one
+// would otherwise quietly count as never earned.
+func (rule rpRule) logMissing(event string, matches []tbaMatch) {
+	var quals []tbaMatch
+	for _, m := range matches {
+		if m.CompLevel == "qm" {
+			quals = append(quals, m)
+		}
+	}
+	if missing := missingBreakdownKeys(quals, append([]string{"rp"}, rule.bonuses...)); len(missing) > 0 {
+		log.Printf("rp: %s score breakdowns have no %s\n", event, strings.Join(missing, ", "))
+	}
+}
+
+// earnedRP is the ranking points an alliance got in a played match, from the
+// breakdown when TBA has it.
+func (rule rpRule) earnedRP(m *tbaMatch, color string) float64 {
+	if rp, ok := m.ScoreBreakdown[color]["rp"].(float64); ok {
+		return rp
+	}
+
+	switch m.outcome(color) {
+	case "W":
+		return rule.win
+	case "T":
+		return rule.tie
+	}
+	return 0
+}
+
+// currentStandings totals the played qualification matches. Surrogate
+// appearances don't count towards a team's ranking.
+func currentStandings(matches []tbaMatch, rule rpRule) map[string]stats.Standing {
+	standings := map[string]stats.Standing{}
+	for i := range matches {
+		m := &matches[i]
+		if m.CompLevel != "qm" || !m.played() {
+			continue
+		}
+
+		for _, color := range []string{"red", "blue"} {
+			a := m.Alliances[color]
+			surrogates := map[string]bool{}
+			for _, key := range a.SurrogateTeamKeys {
+				surrogates[key] = true
+			}
+
+			rp := rule.earnedRP(m, color)
+			for _, key := range a.TeamKeys {
+				s := standings[key]
+				if !surrogates[key] {
+					s.RP += rp
+					s.Points += float64(a.Score)
+					s.Played++
+				}
+				standings[key] = s
+			}
+		}
+	}
+	return standings
+}
+
+// projectionSimulator plays matches from OPR and bonus RP component OPRs
+// once there are results, and from Elo win probabilities before that.
+func projectionSimulator(quals []stats.Match, remaining []stats.Match, rule rpRule) stats.Simulator {
+	elo := currentElo()
+	ratings, err := stats.Compute(quals)
+	if err != nil {
+		return func(m stats.Match, rng *rand.Rand) (red, blue stats.Outcome) {
+			p := elo.WinProbability(m.Red.Teams, m.Blue.Teams)
+			if rng.Float64() < p {
+				return stats.Outcome{RP: rule.win}, stats.Outcome{}
+			}
+			return stats.Outcome{}, stats.Outcome{RP: rule.win}
+		}
+	}
+
+	// Teams without results yet are treated as average.
+	mean := 0.0
+	for _, opr := range ratings.OPR {
+		mean += opr
+	}
+	mean /= float64(len(ratings.OPR))
+	for _, m := range remaining {
+		for _, team := range append(append([]string{}, m.Red.Teams...), m.Blue.Teams...) {
+			if _, ok := ratings.OPR[team]; !ok {
+				ratings.OPR[team] = mean
+			}
+		}
+	}
+	sigma := ratings.Sigma(quals)
+
+	var bonuses []map[string]float64
+	for _, field := range rule.bonuses {
+		if component, err := stats.Component(quals, field); err == nil {
+			bonuses = append(bonuses, component)
+		}
+	}
+
+	play := func(teams []string, rng *rand.Rand) stats.Outcome {
+		o := stats.Outcome{Points: ratings.Score(teams) + sigma*rng.NormFloat64()}
+		for _, component := range bonuses {
+			p := 0.0
+			for _, team := range teams {
+				p += component[team]
+			}
+			if rng.Float64() < p {
+				o.RP++
+			}
+		}
+		return o
+	}
+
+	return func(m stats.Match, rng *rand.Rand) (red, blue stats.Outcome) {
+		red, blue = play(m.Red.Teams, rng), play(m.Blue.Teams, rng)
+		switch {
+		case red.Points > blue.Points:
+			red.RP += rule.win
+		case red.Points < blue.Points:
+			blue.RP += rule.win
+		default:
+			red.RP += rule.tie
+			blue.RP += rule.tie
+		}
+		return red, blue
+	}
+}
+
+func percent(p float64) string {
+	switch {
+	case p == 0:
+		return "-"
+	case p < 0.005:
+		return "<1"
+	case p > 0.995 && p < 1:
+		return ">99"
+	}
+	return fmt.Sprintf("%.0f", 100*p)
+}
+
+func projectCommand(ctx *commandContext) error {
+	event := ctx.str("event")
+	year := 0
+	fmt.Sscanf(event, "%4d", &year)
+	rule, err := rpRuleFor(year)
+	if err != nil {
+		return err
+	}
+
+	matches, err := tbaEventMatches(event)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+
+	var remaining []stats.Match
+	for i := range matches {
+		m := &matches[i]
+		if m.CompLevel == "qm" && !m.played() && m.Alliances["red"] != nil && m.Alliances["blue"] != nil {
+			remaining = append(remaining, stats.Match{
+				Red:  stats.Alliance{Teams: m.Alliances["red"].TeamKeys},
+				Blue: stats.Alliance{Teams: m.Alliances["blue"].TeamKeys},
+			})
+		}
+	}
+	if len(remaining) == 0 {
+		return commandError(fmt.Sprintf("%s doesn't have a qualification schedule left to simulate.", event))
+	}
+
+	rule.logMissing(event, matches)
+	current := currentStandings(matches, rule)
+	quals := qualMatches(matches)
+	sim := projectionSimulator(quals, remaining, rule)
+	p := stats.Project(current, remaining, sim, projectionRuns, projectionLimit, time.Now().UnixNano())
+
+	rankings, err := tbaEventRankings(event)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	now := map[string]int{}
+	for _, r := range rankings.Rankings {
+		now[r.TeamKey] = r.Rank
+	}
+
+	teams := append([]string{}, p.Teams...)
+	sort.Slice(teams, func(i, j int) bool { return p.Rank[teams[i]] < p.Rank[teams[j]] })
+
+	header := fmt.Sprintf("%-6s %3s %5s %4s", "Team", "Now", "Exp", "Top8")
+	for seed := 1; seed <= allianceCount; seed++ {
+		header += fmt.Sprintf(" %3d", seed)
+	}
+
+	var rows []string
+	for _, team := range teams {
+		rank := "-"
+		if now[team] > 0 {
+			rank = fmt.Sprintf("%d", now[team])
+		}
+		row := fmt.Sprintf("%-6s %3s %5.1f %4s", strings.TrimPrefix(team, "frc"), rank, p.Rank[team], percent(p.Top(team, allianceCount)))
+		for seed := 0; seed < allianceCount && seed < len(p.Seeds[team]); seed++ {
+			row += fmt.Sprintf(" %3s", percent(p.Seeds[team][seed]))
+		}
+		rows = append(rows, row)
+	}
+
+	basis := "OPR"
+	if len(quals) == 0 {
+		basis = "Elo"
+	}
+	footer := fmt.Sprintf("%d simulations of %d remaining matches using %s • percentages • ties broken by average score",
+		p.Runs, len(remaining), basis)
+
+	var pages []*discordgo.MessageEmbed
+	for start := 0; start < len(rows); start += projectionsByPage {
+		end := start + projectionsByPage
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "```\n%s\n%s\n```", header, strings.Join(rows[start:end], "\n"))
+		pages = append(pages, &discordgo.MessageEmbed{
+			Title:       event + " ranking projection",
+			URL:         "https://www.thebluealliance.com/event/" + event + "#rankings",
+			Color:       tbaColor,
+			Description: buf.String(),
+			Footer:      &discordgo.MessageEmbedFooter{Text: footer},
+		})
+	}
+
+	_, err = ctx.replyPages(pages)
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "project",
+		aliases: []string{"projection"},
+		summary: "Simulate the rest of an event's qualifications to project the final rankings.",
+		help:    "Shows each team's expected final rank, chance of finishing top 8 and chance of each seed.",
+		args:    []argSpec{{name: "event", kind: argEvent}},
+		run:     projectCommand,
+	})
+}
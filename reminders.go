@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// draftLength is how long a draft is shown as lasting in calendars.
+	draftLength = time.Hour
+
+	// draftFeedDays is how far back finished drafts stay in the feed.
+	draftFeedDays = 90
+)
+
+func draftICS(d *draft) icsEvent {
+	settings := guildSettingsFor(d.Guild)
+	return icsEvent{
+		UID:         fmt.Sprintf("draft-%d@tbc-discord-bot", d.Key),
+		Summary:     d.Name + " draft",
+		Description: fmt.Sprintf("Teams: %s\nRounds: %d", d.Teams, d.Rounds),
+		URL:         d.Teams,
+		Start:       d.Date,
+		End:         d.Date.Add(draftLength),
+		Alarm:       time.Duration(settings.ReminderMinutes) * time.Minute,
+	}
+}
+
+// postDraftICS attaches a calendar file for a newly proposed draft.
+func postDraftICS(dg *discordgo.Session, d *draft) error {
+	data := writeICS(d.Name+" draft", []icsEvent{draftICS(d)})
+	content := fmt.Sprintf(":calendar: Add the **%s** draft to your calendar.", d.Name)
+	if publicURL != "" {
+		token, err := feedToken(d.Guild)
+		if err != nil {
+			return err
+		}
+		content += fmt.Sprintf(" Every draft in this server: <%s/drafts.ics?token=%s>", publicURL, token)
+	}
+
+	_, err := dg.ChannelFileSendWithMessage(d.OrigCh, content, strings.ToLower(d.Name)+"-draft.ics", bytes.NewReader(data))
+	return err
+}
+
+// draftsFeed serves an iCalendar feed of a guild's upcoming and recent
+// drafts. The guild comes from its secret feed token, the same one as its
+// events feed.
+func draftsFeed(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.String(http.StatusBadRequest, string("token is required"))
+		return
+	}
+	guild, err := feedGuild(token)
+	if err != nil {
+		feedError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if guild == "" {
+		c.String(http.StatusNotFound, "unknown feed token")
+		return
+	}
+
+	rows, err := db.Query(selectDraft+" WHERE Guild = $1 AND Status <> $2 AND Date > $3 ORDER BY Date",
+		guild, draftDeleted, time.Now().UTC().AddDate(0, 0, -draftFeedDays))
+	if err != nil {
+		feedError(c, http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	var events []icsEvent
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			feedError(c, http.StatusInternalServerError, err)
+			return
+		}
+		events = append(events, draftICS(d))
+	}
+
+	c.Header("Content-Disposition", "inline; filename=drafts.ics")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", writeICS("Fantasy drafts", events))
+}
+
+// sendDraftReminders DMs drafters who opted in once a draft is within the
+// guild's reminder time. Each drafter is only reminded once, and a draft is
+// marked reminded after every opted in drafter has been sent their DM, so
+// failures are retried on the next run until the draft starts.
+func sendDraftReminders() {
+	dg := session
+	if dg == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	rows, err := db.Query(selectDraft+" WHERE Status IN ($1, $2) AND NOT Reminded AND Date > $3 AND Date < $4",
+		draftProposed, draftActive, now, now.AddDate(0, 0, 7))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	var drafts []*draft
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			log.Println(err)
+			break
+		}
+		drafts = append(drafts, d)
+	}
+	rows.Close()
+
+	for _, d := range drafts {
+		settings := guildSettingsFor(d.Guild)
+		if settings.ReminderMinutes == 0 || time.Until(d.Date) > time.Duration(settings.ReminderMinutes)*time.Minute {
+			continue
+		}
+
+		if remindDrafters(dg, d, settings) {
+			if _, err = db.Exec("UPDATE Drafts SET Reminded = TRUE WHERE Draft_Key = $1", d.Key); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+// remindDrafters DMs every opted in drafter of d who hasn't been reminded
+// yet. It reports whether all of them now have been.
+func remindDrafters(dg *discordgo.Session, d *draft, settings *guildSettings) bool {
+	signups, err := signedUp(d)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+
+	where := "<#" + d.OrigCh + ">"
+	if d.Channel != "" {
+		where = "<#" + d.Channel + ">"
+	}
+	content := fmt.Sprintf("The **%s** draft starts at %s in %s.", d.Name,
+		d.Date.In(settings.location()).Format("Mon Jan 2 15:04 MST"), where)
+
+	done := true
+	for _, member := range signups {
+		var pending bool
+		err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM Draft_Reminder_Optins WHERE Guild = $1 AND Member = $2)
+			AND NOT EXISTS (SELECT 1 FROM Draft_Reminders_Sent WHERE Draft_Key = $3 AND Member = $2)`,
+			d.Guild, member, d.Key).Scan(&pending)
+		if err != nil {
+			log.Println(err)
+			done = false
+			continue
+		}
+		if !pending {
+			continue
+		}
+
+		if sendDM(dg, member, content) != nil {
+			done = false
+			continue
+		}
+		_, err = db.Exec("INSERT INTO Draft_Reminders_Sent (Draft_Key, Member) VALUES ($1, $2) ON CONFLICT DO NOTHING", d.Key, member)
+		if err != nil {
+			log.Println(err)
+			done = false
+		}
+	}
+	return done
+}
+
+// setDraftReminders opts a member in or out of draft reminder DMs.
+func setDraftReminders(ctx *commandContext, on bool) error {
+	if ctx.guild == "" {
+		return commandError("Reminders are set per server, so use this in a server channel.")
+	}
+
+	var err error
+	if on {
+		_, err = db.Exec("INSERT INTO Draft_Reminder_Optins (Guild, Member) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			ctx.guild, ctx.msg.Author.ID)
+	} else {
+		_, err = db.Exec("DELETE FROM Draft_Reminder_Optins WHERE Guild = $1 AND Member = $2", ctx.guild, ctx.msg.Author.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !on {
+		_, err = ctx.reply("You won't get draft reminders from this server anymore.")
+		return err
+	}
+	if ctx.settings.ReminderMinutes == 0 {
+		_, err = ctx.reply("You're opted in, but this server has reminders turned off. An admin can turn them on with `config set reminder 30`.")
+		return err
+	}
+	_, err = ctx.reply(fmt.Sprintf("You'll get a DM %d minutes before drafts you've signed up for.", ctx.settings.ReminderMinutes))
+	return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// rankedTeams lists team keys with their current rank, e.g. "1678 (#3)".
+func rankedTeams(keys []string, skip string, ranks map[string]int) string {
+	var teams []string
+	for _, key := range keys {
+		if key == skip {
+			continue
+		}
+		team := strings.TrimPrefix(key, "frc")
+		if rank, ok := ranks[key]; ok {
+			team += fmt.Sprintf(" (#%d)", rank)
+		}
+		teams = append(teams, team)
+	}
+	return strings.Join(teams, ", ")
+}
+
+// matchTime is the best guess at when a match starts: TBA's prediction if it
+// has one, otherwise the published schedule.
+func matchTime(m *tbaMatch) int64 {
+	if m.PredictedTime != 0 {
+		return m.PredictedTime
+	}
+	return m.Time
+}
+
+func scheduleCommand(ctx *commandContext) error {
+	team := ctx.str("team")
+	key := teamKey(team)
+	year := time.Now().Year()
+
+	eventCode, eventName := determineEvent(team, year)
+	if eventCode == "" {
+		return commandError(fmt.Sprintf("Team %s doesn't have a current or recent event this year.", team))
+	}
+	event := fmt.Sprintf("%d%s", year, eventCode)
+
+	matches, err := tbaTeamEventMatches(team, event)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+	rankings, err := tbaEventRankings(event)
+	if err = ignoreNotFound(err); err != nil {
+		return err
+	}
+
+	ranks := map[string]int{}
+	for _, ranking := range rankings.Rankings {
+		ranks[ranking.TeamKey] = ranking.Rank
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matchLess(&matches[i], &matches[j]) })
+
+	loc := ctx.settings.location()
+	var upcoming []string
+	var completed bytes.Buffer
+	wins, losses, ties := 0, 0, 0
+	for i := range matches {
+		m := &matches[i]
+		color := m.allianceOf(key)
+		if color == "" {
+			continue
+		}
+		ours, theirs := m.Alliances[color], m.Alliances[opponent(color)]
+
+		if !m.played() {
+			upcoming = append(upcoming, fmt.Sprintf("**%s** %s (%s)\nwith %s\nvs %s",
+				shortMatchName(m), formatUnix(matchTime(m), loc), color,
+				orNone(rankedTeams(ours.TeamKeys, key, ranks)), rankedTeams(theirs.TeamKeys, "", ranks)))
+			continue
+		}
+
+		result := m.outcome(color)
+		switch result {
+		case "W":
+			wins++
+		case "L":
+			losses++
+		default:
+			ties++
+		}
+		fmt.Fprintf(&completed, "%-7s %s %3d-%-3d %s\n", shortMatchName(m), result, ours.Score, theirs.Score, color)
+	}
+
+	title := fmt.Sprintf("%s at %s", team, eventName)
+	if rank, ok := ranks[key]; ok {
+		title += fmt.Sprintf(" (rank %d)", rank)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       title,
+		URL:         fmt.Sprintf("https://www.thebluealliance.com/team/%s/%d", team, year),
+		Color:       tbaColor,
+		Description: fmt.Sprintf("Record %d-%d-%d", wins, losses, ties),
+	}
+
+	if len(upcoming) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Upcoming",
+			Value: truncate(strings.Join(upcoming, "\n\n"), 1024),
+		})
+	} else {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Upcoming", Value: "No more matches scheduled."})
+	}
+
+	if completed.Len() > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Completed",
+			Value: "```\n" + truncate(completed.String(), 1000) + "```",
+		})
+	}
+
+	_, err = ctx.replyEmbed(embed)
+	return err
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "schedule",
+		aliases: []string{"next"},
+		summary: "List a team's remaining and completed matches at its current event.",
+		help:    "Times use the server's timezone setting.",
+		args:    []argSpec{{name: "team", kind: argTeam}},
+		run:     scheduleCommand,
+	})
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	customEmojiRegex = regexp.MustCompile(`^<a?:(\w+):(\d+)>$`)
+	signupMutex      = &sync.Mutex{}
+	rejected         = map[string]bool{}
+)
+
+// parseEmoji turns a custom emoji mention into the name:id form the reaction
+// endpoints expect. Unicode emoji are returned unchanged.
+func parseEmoji(value string) string {
+	if match := customEmojiRegex.FindStringSubmatch(value); match != nil {
+		return match[1] + ":" + match[2]
+	}
+	return value
+}
+
+func showEmoji(emoji string) string {
+	if strings.Contains(emoji, ":") {
+		return "<:" + emoji + ">"
+	}
+	return emoji
+}
+
+// emojiMatches reports whether a reaction used the configured sign-up emoji.
+func emojiMatches(emoji string, reaction discordgo.Emoji) bool {
+	if i := strings.Index(emoji, ":"); i >= 0 {
+		return reaction.ID == emoji[i+1:]
+	}
+	return reaction.Name == emoji
+}
+
+// reactionUsers pages through everyone who reacted to a message with emoji.
+// The vendored MessageReactions only returns the first page.
+func reactionUsers(dg *discordgo.Session, channelID, messageID, emoji string) ([]*discordgo.User, error) {
+	var users []*discordgo.User
+	after := ""
+	for {
+		uri := discordgo.EndpointMessageReactions(channelID, messageID, emoji) + "?limit=100"
+		if after != "" {
+			uri += "&after=" + after
+		}
+
+		body, err := dg.RequestWithBucketID("GET", uri, nil, discordgo.EndpointMessageReaction(channelID, "", "", ""))
+		if err != nil {
+			return nil, err
+		}
+
+		var page []*discordgo.User
+		if err = json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+
+		users = append(users, page...)
+		if len(page) < 100 {
+			return users, nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// signedUp returns the IDs of everyone in a draft's sign-up table, in the
+// order they joined.
+func signedUp(d *draft) ([]string, error) {
+	rows, err := db.Query("SELECT Member FROM Draft_Signups WHERE Draft_Key = $1 ORDER BY Joined_At", d.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []string
+	for rows.Next() {
+		var member string
+		if err = rows.Scan(&member); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// draftSignups reconciles the sign-up table with the reactions on the
+// proposal, in case reactions changed while the bot was offline. Members who
+// joined first keep their spot, and the result is capped at the guild's
+// maximum number of drafters.
+func draftSignups(dg *discordgo.Session, d *draft) ([]string, error) {
+	settings := guildSettingsFor(d.Guild)
+	users, err := reactionUsers(dg, d.OrigCh, d.Msg, settings.SignupEmoji)
+	if err != nil {
+		return nil, err
+	}
+
+	reacted := map[string]bool{}
+	for _, user := range users {
+		if !user.Bot {
+			reacted[user.ID] = true
+		}
+	}
+
+	joined, err := signedUp(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var signups []string
+	for _, member := range joined {
+		if reacted[member] {
+			signups = append(signups, member)
+			delete(reacted, member)
+		}
+	}
+	for _, user := range users {
+		if reacted[user.ID] {
+			signups = append(signups, user.ID)
+		}
+	}
+
+	if settings.MaxDrafters > 0 && len(signups) > settings.MaxDrafters {
+		signups = signups[:settings.MaxDrafters]
+	}
+	return signups, nil
+}
+
+func rosterEmbed(d *draft, signups []string) *discordgo.MessageEmbed {
+	settings := guildSettingsFor(d.Guild)
+
+	var names []string
+	for _, member := range signups {
+		names = append(names, "<@"+member+">")
+	}
+	roster := strings.Join(names, "\n")
+	if roster == "" {
+		roster = "Nobody yet"
+	}
+
+	count := fmt.Sprintf("%d", len(signups))
+	if settings.MaxDrafters > 0 {
+		count += fmt.Sprintf("/%d", settings.MaxDrafters)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: d.Name + " draft",
+		URL:   d.Teams,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Date", Value: d.Date.In(settings.location()).Format("Mon Jan 2 15:04 MST"), Inline: true},
+			{Name: "Rounds", Value: fmt.Sprintf("%d", d.Rounds), Inline: true},
+			{Name: "Drafters (" + count + ")", Value: roster},
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "React to the proposal with " + showEmoji(settings.SignupEmoji) + " to join",
+		},
+	}
+}
+
+// postRoster sets up sign-ups for a new proposal: the bot reacts with the
+// sign-up emoji and posts the roster message it keeps up to date.
+func postRoster(dg *discordgo.Session, d *draft) error {
+	settings := guildSettingsFor(d.Guild)
+	if err := dg.MessageReactionAdd(d.OrigCh, d.Msg, settings.SignupEmoji); err != nil {
+		log.Println(err)
+	}
+
+	roster, err := dg.ChannelMessageSendEmbed(d.OrigCh, rosterEmbed(d, nil))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE Drafts SET Roster_Msg = $1 WHERE Draft_Key = $2", roster.ID, d.Key)
+	return err
+}
+
+func updateRoster(dg *discordgo.Session, d *draft) error {
+	signups, err := signedUp(d)
+	if err != nil {
+		return err
+	}
+
+	var rosterMsg string
+	err = db.QueryRow("SELECT COALESCE(Roster_Msg, '') FROM Drafts WHERE Draft_Key = $1", d.Key).Scan(&rosterMsg)
+	if err != nil || rosterMsg == "" {
+		return err
+	}
+
+	_, err = dg.ChannelMessageEditEmbed(d.OrigCh, rosterMsg, rosterEmbed(d, signups))
+	return err
+}
+
+// sendDM messages a member directly. Failures are logged and returned for
+// callers that need to retry.
+func sendDM(dg *discordgo.Session, userID, content string) error {
+	ch, err := dg.UserChannelCreate(userID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if _, err = dg.ChannelMessageSend(ch.ID, content); err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+// proposalFor returns the open draft proposed in messageID, or nil.
+func proposalFor(messageID string) *draft {
+	d, err := scanDraft(db.QueryRow(selectDraft+" WHERE Msg = $1 AND Status = $2", messageID, draftProposed))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return d
+}
+
+func rejectionKey(messageID, userID string) string {
+	return messageID + "/" + userID
+}
+
+func signupAdded(dg *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r.UserID == dg.State.User.ID {
+		return
+	}
+
+	d := proposalFor(r.MessageID)
+	if d == nil {
+		return
+	}
+
+	settings := guildSettingsFor(d.Guild)
+	if !emojiMatches(settings.SignupEmoji, r.Emoji) {
+		return
+	}
+
+	signupMutex.Lock()
+	defer signupMutex.Unlock()
+
+	joined, err := signedUp(d)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, member := range joined {
+		if member == r.UserID {
+			return
+		}
+	}
+
+	if settings.MaxDrafters > 0 && len(joined) >= settings.MaxDrafters {
+		rejected[rejectionKey(r.MessageID, r.UserID)] = true
+		if err = dg.MessageReactionRemove(r.ChannelID, r.MessageID, settings.SignupEmoji, r.UserID); err != nil {
+			log.Println(err)
+		}
+		sendDM(dg, r.UserID, fmt.Sprintf("Sorry, the **%s** draft is full (%d drafters).", d.Name, settings.MaxDrafters))
+		return
+	}
+
+	_, err = db.Exec("INSERT INTO Draft_Signups (Draft_Key, Member, Joined_At) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		d.Key, r.UserID, time.Now())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	sendDM(dg, r.UserID, fmt.Sprintf("You're signed up for the **%s** draft on %s. Remove your %s reaction to drop out.",
+		d.Name, d.Date.In(settings.location()).Format("Mon Jan 2 15:04 MST"), showEmoji(settings.SignupEmoji)))
+
+	if err = updateRoster(dg, d); err != nil {
+		log.Println(err)
+	}
+}
+
+func signupRemoved(dg *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	if r.UserID == dg.State.User.ID {
+		return
+	}
+
+	d := proposalFor(r.MessageID)
+	if d == nil || !emojiMatches(guildSettingsFor(d.Guild).SignupEmoji, r.Emoji) {
+		return
+	}
+
+	signupMutex.Lock()
+	defer signupMutex.Unlock()
+
+	// Reactions the bot removed because the draft was full don't count as
+	// leaving.
+	key := rejectionKey(r.MessageID, r.UserID)
+	if rejected[key] {
+		delete(rejected, key)
+		return
+	}
+
+	res, err := db.Exec("DELETE FROM Draft_Signups WHERE Draft_Key = $1 AND Member = $2", d.Key, r.UserID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return
+	}
+
+	sendDM(dg, r.UserID, fmt.Sprintf("You've left the **%s** draft.", d.Name))
+
+	if err = updateRoster(dg, d); err != nil {
+		log.Println(err)
+	}
+}
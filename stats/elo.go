@@ -0,0 +1,97 @@
+package stats
+
+import "math"
+
+// Elo rates teams by updating every team on an alliance by the same amount
+// after each match, based on how surprising the result was.
+type Elo struct {
+	Ratings map[string]float64
+
+	// Mean is the rating of new teams and what ratings regress towards
+	// between seasons.
+	Mean float64
+	// K is the largest change one qualification match can make.
+	K float64
+	// PlayoffK is K for playoff matches, which say less about a team since
+	// alliances are stacked.
+	PlayoffK float64
+	// Regression is the fraction of the distance to Mean a rating loses at
+	// the start of each season.
+	Regression float64
+}
+
+// NewElo returns an Elo model with the default parameters.
+func NewElo() *Elo {
+	return &Elo{
+		Ratings:    map[string]float64{},
+		Mean:       1500,
+		K:          32,
+		PlayoffK:   12,
+		Regression: 0.25,
+	}
+}
+
+// Rating returns a team's rating, or Mean for teams that haven't played.
+func (e *Elo) Rating(team string) float64 {
+	if r, ok := e.Ratings[team]; ok {
+		return r
+	}
+	return e.Mean
+}
+
+// AllianceRating is the mean rating of an alliance's teams.
+func (e *Elo) AllianceRating(teams []string) float64 {
+	if len(teams) == 0 {
+		return e.Mean
+	}
+	sum := 0.0
+	for _, team := range teams {
+		sum += e.Rating(team)
+	}
+	return sum / float64(len(teams))
+}
+
+// WinProbability is the chance the red alliance beats the blue alliance.
+func (e *Elo) WinProbability(red, blue []string) float64 {
+	return 1 / (1 + math.Pow(10, (e.AllianceRating(blue)-e.AllianceRating(red))/400))
+}
+
+// Update applies a played match to the ratings and returns how much each
+// team's rating changed.
+func (e *Elo) Update(m Match, playoff bool) map[string]float64 {
+	k := e.K
+	if playoff {
+		k = e.PlayoffK
+	}
+
+	delta := k * (m.Result() - e.WinProbability(m.Red.Teams, m.Blue.Teams))
+	changes := map[string]float64{}
+	for _, team := range m.Red.Teams {
+		changes[team] += delta
+	}
+	for _, team := range m.Blue.Teams {
+		changes[team] -= delta
+	}
+	for team, change := range changes {
+		e.Ratings[team] = e.Rating(team) + change
+	}
+	return changes
+}
+
+// NewSeason regresses every rating towards the mean.
+func (e *Elo) NewSeason() {
+	for team, r := range e.Ratings {
+		e.Ratings[team] = r - e.Regression*(r-e.Mean)
+	}
+}
+
+// Copy returns an independent copy of the model, so changes can be made and
+// thrown away without touching the original.
+func (e *Elo) Copy() *Elo {
+	c := *e
+	c.Ratings = make(map[string]float64, len(e.Ratings))
+	for team, r := range e.Ratings {
+		c.Ratings[team] = r
+	}
+	return &c
+}
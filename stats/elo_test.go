@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEloUpdate(t *testing.T) {
+	e := NewElo()
+	red, blue := []string{"a", "b"}, []string{"c", "d"}
+
+	// Evenly matched alliances split K between a win and a loss.
+	changes := e.Update(Match{Red: Alliance{Teams: red, Score: 50}, Blue: Alliance{Teams: blue, Score: 40}}, false)
+	if !near(changes["a"], 16) || !near(changes["c"], -16) {
+		t.Errorf("changes = %v, want ±16", changes)
+	}
+	if !near(e.Rating("b"), 1516) || !near(e.Rating("d"), 1484) {
+		t.Errorf("ratings = %v, want 1516 and 1484", e.Ratings)
+	}
+
+	// Red is now 32 points better, so a blue playoff win moves more than
+	// half of PlayoffK.
+	p := 1 / (1 + math.Pow(10, -32.0/400))
+	changes = e.Update(Match{Red: Alliance{Teams: red, Score: 40}, Blue: Alliance{Teams: blue, Score: 50}}, true)
+	if want := -12 * p; !near(changes["a"], want) {
+		t.Errorf("playoff change = %g, want %g", changes["a"], want)
+	}
+
+	// A 400 point gap is 10 to 1 odds.
+	e.Ratings = map[string]float64{"a": 1900, "c": 1500}
+	if got := e.WinProbability([]string{"a"}, []string{"c"}); !near(got, 10.0/11) {
+		t.Errorf("WinProbability = %g, want %g", got, 10.0/11)
+	}
+}
+
+func TestEloNewSeason(t *testing.T) {
+	e := NewElo()
+	e.Ratings = map[string]float64{"a": 1700, "b": 1300, "c": 1500}
+	e.NewSeason()
+
+	want := map[string]float64{"a": 1650, "b": 1350, "c": 1500}
+	for team, w := range want {
+		if got := e.Ratings[team]; !near(got, w) {
+			t.Errorf("Ratings[%s] = %g, want %g", team, got, w)
+		}
+	}
+}
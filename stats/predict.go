@@ -0,0 +1,97 @@
+package stats
+
+import "math"
+
+// Score projects an alliance's score as the sum of its teams' OPRs.
+func (r *Ratings) Score(teams []string) float64 {
+	sum := 0.0
+	for _, team := range teams {
+		sum += r.OPR[team]
+	}
+	return sum
+}
+
+// Sigma is the standard deviation of the difference between projected and
+// actual alliance scores over matches.
+func (r *Ratings) Sigma(matches []Match) float64 {
+	if len(matches) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, m := range matches {
+		for _, a := range []Alliance{m.Red, m.Blue} {
+			d := a.Score - r.Score(a.Teams)
+			sum += d * d
+		}
+	}
+	return math.Sqrt(sum / float64(2*len(matches)))
+}
+
+// MarginProbability turns a projected score margin into the chance the
+// margin is positive, assuming each alliance's score is off by a normally
+// distributed error with standard deviation sigma.
+func MarginProbability(margin, sigma float64) float64 {
+	if sigma <= 0 {
+		switch {
+		case margin > 0:
+			return 1
+		case margin < 0:
+			return 0
+		}
+		return 0.5
+	}
+	// The margin's error is the difference of two alliance errors.
+	return 0.5 * (1 + math.Erf(margin/(sigma*math.Sqrt2*math.Sqrt2)))
+}
+
+// Backtest scores a series of win probabilities against actual results.
+type Backtest struct {
+	Matches int
+	// Decided counts the matches that didn't end in a tie.
+	Decided int
+	Correct int
+	brier   float64
+}
+
+// Add records a prediction that red wins with probability p. result is 1 if
+// red won, 0 if blue won and 0.5 for a tie. Ties don't count towards
+// accuracy.
+func (b *Backtest) Add(p, result float64) {
+	b.Matches++
+	b.brier += (p - result) * (p - result)
+	if result != 0.5 {
+		b.Decided++
+	}
+	if (p > 0.5 && result == 1) || (p < 0.5 && result == 0) {
+		b.Correct++
+	}
+}
+
+// Brier is the mean squared error of the predictions. Always guessing 50%
+// scores 0.25, lower is better.
+func (b *Backtest) Brier() float64 {
+	if b.Matches == 0 {
+		return 0
+	}
+	return b.brier / float64(b.Matches)
+}
+
+// Accuracy is the fraction of decided matches where the favorite won.
+func (b *Backtest) Accuracy() float64 {
+	if b.Decided == 0 {
+		return 0
+	}
+	return float64(b.Correct) / float64(b.Decided)
+}
+
+// Result converts a match's scores into the result used by Backtest.
+func (m Match) Result() float64 {
+	switch {
+	case m.Red.Score > m.Blue.Score:
+		return 1
+	case m.Red.Score < m.Blue.Score:
+		return 0
+	}
+	return 0.5
+}
@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMarginProbability(t *testing.T) {
+	tests := []struct {
+		margin, sigma, want float64
+	}{
+		{0, 10, 0.5},
+		// The margin's standard deviation is σ√2, so a margin of σ√2 is
+		// one standard deviation: Φ(1).
+		{10 * math.Sqrt2, 10, 0.841344746},
+		{-10 * math.Sqrt2, 10, 0.158655254},
+		// Two standard deviations: Φ(2).
+		{40 * math.Sqrt2, 20, 0.977249868},
+		{5, 0, 1},
+		{-5, 0, 0},
+		{0, 0, 0.5},
+	}
+	for _, test := range tests {
+		if got := MarginProbability(test.margin, test.sigma); !near(got, test.want) {
+			t.Errorf("MarginProbability(%g, %g) = %g, want %g", test.margin, test.sigma, got, test.want)
+		}
+	}
+}
+
+func TestBacktest(t *testing.T) {
+	var b Backtest
+	b.Add(0.8, 1)
+	b.Add(0.6, 0)
+	b.Add(0.3, 0)
+	// A tie counts towards the Brier score but not accuracy.
+	b.Add(0.7, 0.5)
+
+	if b.Matches != 4 || b.Decided != 3 || b.Correct != 2 {
+		t.Errorf("Matches, Decided, Correct = %d, %d, %d, want 4, 3, 2", b.Matches, b.Decided, b.Correct)
+	}
+	if got, want := b.Accuracy(), 2.0/3; !near(got, want) {
+		t.Errorf("Accuracy = %g, want %g", got, want)
+	}
+	if got, want := b.Brier(), (0.04+0.36+0.09+0.04)/4; !near(got, want) {
+		t.Errorf("Brier = %g, want %g", got, want)
+	}
+
+	var ties Backtest
+	ties.Add(0.5, 0.5)
+	if got := ties.Accuracy(); got != 0 {
+		t.Errorf("Accuracy with only ties = %g, want 0", got)
+	}
+}
@@ -0,0 +1,161 @@
+package stats
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Standing is a team's qualification totals, which ranking is based on.
+type Standing struct {
+	RP     float64
+	Points float64
+	Played int
+}
+
+// Outcome is what one alliance earns from a simulated match.
+type Outcome struct {
+	RP     float64
+	Points float64
+}
+
+// Simulator plays out a match that hasn't happened yet.
+type Simulator func(m Match, rng *rand.Rand) (red, blue Outcome)
+
+// Projection summarizes many simulations of the rest of an event's
+// qualification schedule.
+type Projection struct {
+	Teams []string
+	Runs  int
+
+	// Rank is each team's mean final rank.
+	Rank map[string]float64
+
+	// Seeds[team][i] is the chance a team finishes rank i+1.
+	Seeds map[string][]float64
+}
+
+// Top is the chance a team finishes in the top n.
+func (p *Projection) Top(team string, n int) float64 {
+	sum := 0.0
+	for i, prob := range p.Seeds[team] {
+		if i >= n {
+			break
+		}
+		sum += prob
+	}
+	return sum
+}
+
+// Project simulates the remaining matches from the current standings until
+// it has done runs simulations or limit has passed, whichever comes first.
+// Teams are ranked by average ranking points, then average match points,
+// with remaining ties broken at random.
+func Project(current map[string]Standing, remaining []Match, sim Simulator, runs int, limit time.Duration, seed int64) *Projection {
+	rng := rand.New(rand.NewSource(seed))
+	deadline := time.Now().Add(limit)
+
+	index := map[string]int{}
+	var teams []string
+	for team := range current {
+		index[team] = len(teams)
+		teams = append(teams, team)
+	}
+	for _, m := range remaining {
+		for _, team := range append(append([]string{}, m.Red.Teams...), m.Blue.Teams...) {
+			if _, ok := index[team]; !ok {
+				index[team] = len(teams)
+				teams = append(teams, team)
+			}
+		}
+	}
+	sort.Strings(teams)
+	for i, team := range teams {
+		index[team] = i
+	}
+
+	n := len(teams)
+	counts := make([][]int, n)
+	for i := range counts {
+		counts[i] = make([]int, n)
+	}
+	rankSums := make([]int, n)
+
+	standings := make([]Standing, n)
+	order := make([]int, n)
+	jitter := make([]float64, n)
+	done := 0
+	for done < runs {
+		if done%100 == 0 && done > 0 && time.Now().After(deadline) {
+			break
+		}
+
+		for i, team := range teams {
+			standings[i] = current[team]
+		}
+		for _, m := range remaining {
+			red, blue := sim(m, rng)
+			for _, team := range m.Red.Teams {
+				s := &standings[index[team]]
+				s.RP += red.RP
+				s.Points += red.Points
+				s.Played++
+			}
+			for _, team := range m.Blue.Teams {
+				s := &standings[index[team]]
+				s.RP += blue.RP
+				s.Points += blue.Points
+				s.Played++
+			}
+		}
+
+		for i := range order {
+			order[i] = i
+			jitter[i] = rng.Float64()
+		}
+		sort.Slice(order, func(a, b int) bool {
+			sa, sb := standings[order[a]], standings[order[b]]
+			ra, rb := average(sa.RP, sa.Played), average(sb.RP, sb.Played)
+			if ra != rb {
+				return ra > rb
+			}
+			pa, pb := average(sa.Points, sa.Played), average(sb.Points, sb.Played)
+			if pa != pb {
+				return pa > pb
+			}
+			return jitter[order[a]] < jitter[order[b]]
+		})
+
+		for rank, i := range order {
+			counts[i][rank]++
+			rankSums[i] += rank + 1
+		}
+		done++
+	}
+
+	p := &Projection{
+		Teams: teams,
+		Runs:  done,
+		Rank:  map[string]float64{},
+		Seeds: map[string][]float64{},
+	}
+	if done == 0 {
+		return p
+	}
+	for i, team := range teams {
+		p.Rank[team] = float64(rankSums[i]) / float64(done)
+		seeds := make([]float64, n)
+		for rank, count := range counts[i] {
+			seeds[rank] = float64(count) / float64(done)
+		}
+		p.Seeds[team] = seeds
+	}
+	return p
+}
+
+func average(total float64, played int) float64 {
+	if played == 0 {
+		return 0
+	}
+	return total / float64(played)
+}
@@ -0,0 +1,64 @@
+package stats
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestProject(t *testing.T) {
+	current := map[string]Standing{
+		"a": {RP: 4, Points: 20, Played: 2},
+		"b": {RP: 2, Points: 20, Played: 2},
+		"c": {RP: 0, Points: 20, Played: 2},
+		"d": {RP: 6, Points: 20, Played: 2},
+	}
+	// e hasn't played yet, and red always wins.
+	remaining := []Match{{Red: Alliance{Teams: []string{"c", "e"}}, Blue: Alliance{Teams: []string{"d"}}}}
+	sim := func(m Match, rng *rand.Rand) (red, blue Outcome) {
+		return Outcome{RP: 10, Points: 10}, Outcome{RP: 0, Points: 10}
+	}
+
+	p := Project(current, remaining, sim, 1000, time.Minute, 1)
+	if p.Runs != 1000 {
+		t.Errorf("Runs = %d, want 1000", p.Runs)
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; len(p.Teams) != len(want) {
+		t.Fatalf("Teams = %v, want %v", p.Teams, want)
+	}
+
+	// e averages 10 RP, c 3.33, then a and d tie on 2 RP and 10 points, and
+	// b is last. The tie is broken at random.
+	for team, want := range map[string]float64{"e": 1, "c": 2, "b": 5} {
+		if got := p.Rank[team]; got != want {
+			t.Errorf("Rank[%s] = %g, want %g", team, got, want)
+		}
+	}
+	for _, team := range []string{"a", "d"} {
+		if got := p.Rank[team]; got < 3.4 || got > 3.6 {
+			t.Errorf("Rank[%s] = %g, want about 3.5", team, got)
+		}
+		if got := p.Top(team, 2); got != 0 {
+			t.Errorf("Top(%s, 2) = %g, want 0", team, got)
+		}
+		if got := p.Top(team, 4); !near(got, 1) {
+			t.Errorf("Top(%s, 4) = %g, want 1", team, got)
+		}
+	}
+	if got := p.Seeds["e"][0]; got != 1 {
+		t.Errorf("Seeds[e][0] = %g, want 1", got)
+	}
+}
+
+func TestProjectLimit(t *testing.T) {
+	// A run that can't finish in time still reports what it managed.
+	sim := func(m Match, rng *rand.Rand) (red, blue Outcome) {
+		time.Sleep(time.Millisecond)
+		return Outcome{}, Outcome{}
+	}
+	remaining := []Match{{Red: Alliance{Teams: []string{"a"}}, Blue: Alliance{Teams: []string{"b"}}}}
+	p := Project(nil, remaining, sim, 1000000, 10*time.Millisecond, 1)
+	if p.Runs == 0 || p.Runs >= 1000000 {
+		t.Errorf("Runs = %d, want a partial run", p.Runs)
+	}
+}
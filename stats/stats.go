@@ -0,0 +1,240 @@
+// Package stats computes team strength estimates from FRC match results.
+package stats
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// ErrNoMatches is returned when there is nothing to compute ratings from.
+var ErrNoMatches = errors.New("stats: no matches")
+
+// Alliance is one side of a played match.
+type Alliance struct {
+	Teams []string
+	Score float64
+	// Values holds numeric score breakdown fields, keyed by field name.
+	Values map[string]float64
+}
+
+// Match is a played match between two alliances.
+type Match struct {
+	Red  Alliance
+	Blue Alliance
+}
+
+// Ratings holds the least-squares contribution estimates for every team that
+// played in the matches they were computed from.
+type Ratings struct {
+	Teams []string
+	OPR   map[string]float64
+	DPR   map[string]float64
+	CCWM  map[string]float64
+}
+
+// ridge keeps the normal equations solvable when a team has played too few
+// matches for its contribution to be fully determined.
+const ridge = 1e-6
+
+// system is the normal equations AᵀA x = Aᵀb for a set of matches, where each
+// row of A marks the teams on one alliance.
+type system struct {
+	index map[string]int
+	teams []string
+	ata   [][]float64
+}
+
+func newSystem(matches []Match) *system {
+	s := &system{index: map[string]int{}}
+	for _, m := range matches {
+		for _, a := range []Alliance{m.Red, m.Blue} {
+			for _, team := range a.Teams {
+				if _, ok := s.index[team]; !ok {
+					s.index[team] = len(s.teams)
+					s.teams = append(s.teams, team)
+				}
+			}
+		}
+	}
+	sort.Strings(s.teams)
+	for i, team := range s.teams {
+		s.index[team] = i
+	}
+
+	n := len(s.teams)
+	s.ata = make([][]float64, n)
+	for i := range s.ata {
+		s.ata[i] = make([]float64, n)
+		s.ata[i][i] = ridge
+	}
+	for _, m := range matches {
+		for _, a := range []Alliance{m.Red, m.Blue} {
+			for _, t1 := range a.Teams {
+				for _, t2 := range a.Teams {
+					s.ata[s.index[t1]][s.index[t2]]++
+				}
+			}
+		}
+	}
+	return s
+}
+
+// rhs builds Aᵀb where b is value(alliance, opponent) for each alliance.
+func (s *system) rhs(matches []Match, value func(a, opp *Alliance) float64) []float64 {
+	b := make([]float64, len(s.teams))
+	for i := range matches {
+		m := &matches[i]
+		for _, pair := range [][2]*Alliance{{&m.Red, &m.Blue}, {&m.Blue, &m.Red}} {
+			v := value(pair[0], pair[1])
+			for _, team := range pair[0].Teams {
+				b[s.index[team]] += v
+			}
+		}
+	}
+	return b
+}
+
+func (s *system) solve(b []float64) (map[string]float64, error) {
+	x, err := choleskySolve(s.ata, b)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]float64, len(s.teams))
+	for i, team := range s.teams {
+		result[team] = x[i]
+	}
+	return result, nil
+}
+
+// Compute returns OPR, DPR and CCWM for every team in matches.
+func Compute(matches []Match) (*Ratings, error) {
+	if len(matches) == 0 {
+		return nil, ErrNoMatches
+	}
+
+	s := newSystem(matches)
+	opr, err := s.solve(s.rhs(matches, func(a, opp *Alliance) float64 { return a.Score }))
+	if err != nil {
+		return nil, err
+	}
+	dpr, err := s.solve(s.rhs(matches, func(a, opp *Alliance) float64 { return opp.Score }))
+	if err != nil {
+		return nil, err
+	}
+
+	ccwm := make(map[string]float64, len(opr))
+	for team := range opr {
+		ccwm[team] = opr[team] - dpr[team]
+	}
+
+	return &Ratings{Teams: s.teams, OPR: opr, DPR: dpr, CCWM: ccwm}, nil
+}
+
+// Component returns each team's contribution to a single score breakdown
+// field, such as "autoPoints". Alliances missing the field count as zero.
+func Component(matches []Match, field string) (map[string]float64, error) {
+	if len(matches) == 0 {
+		return nil, ErrNoMatches
+	}
+
+	s := newSystem(matches)
+	return s.solve(s.rhs(matches, func(a, opp *Alliance) float64 { return a.Values[field] }))
+}
+
+// Fields lists the breakdown fields present in every alliance of matches.
+func Fields(matches []Match) []string {
+	counts := map[string]int{}
+	for _, m := range matches {
+		for _, a := range []Alliance{m.Red, m.Blue} {
+			for field := range a.Values {
+				counts[field]++
+			}
+		}
+	}
+
+	var fields []string
+	for field, count := range counts {
+		if count == 2*len(matches) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Last returns the most recent n matches each team played in. Matches must
+// be in the order they were played.
+func Last(matches []Match, n int) []Match {
+	played := map[string]int{}
+	keep := make([]bool, len(matches))
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		for _, a := range []Alliance{m.Red, m.Blue} {
+			for _, team := range a.Teams {
+				if played[team] < n {
+					keep[i] = true
+				}
+			}
+		}
+		if keep[i] {
+			for _, a := range []Alliance{m.Red, m.Blue} {
+				for _, team := range a.Teams {
+					played[team]++
+				}
+			}
+		}
+	}
+
+	var last []Match
+	for i, m := range matches {
+		if keep[i] {
+			last = append(last, m)
+		}
+	}
+	return last
+}
+
+// choleskySolve solves a x = b for a symmetric positive definite matrix a.
+func choleskySolve(a [][]float64, b []float64) ([]float64, error) {
+	n := len(a)
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, i+1)
+		for j := 0; j <= i; j++ {
+			sum := a[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				if sum <= 0 {
+					return nil, errors.New("stats: matrix is not positive definite")
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+
+	// Forward substitution for L y = b, then back substitution for Lᵀ x = y.
+	y := make([]float64, n)
+	for i := 0; i < n; i++ {
+		sum := b[i]
+		for k := 0; k < i; k++ {
+			sum -= l[i][k] * y[k]
+		}
+		y[i] = sum / l[i][i]
+	}
+
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		sum := y[i]
+		for k := i + 1; k < n; k++ {
+			sum -= l[k][i] * x[k]
+		}
+		x[i] = sum / l[i][i]
+	}
+	return x, nil
+}
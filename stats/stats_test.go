@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+const tolerance = 1e-4
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < tolerance
+}
+
+// threeTeams are scored so that a, b and c contribute exactly 10, 20 and 5
+// points. Solving the normal equations by hand, with AᵀA = [3 1 1; 1 3 1;
+// 1 1 3], gives DPRs of 11, 1 and 16.
+var threeTeams = []Match{
+	{Red: Alliance{Teams: []string{"a", "b"}, Score: 30}, Blue: Alliance{Teams: []string{"c"}, Score: 5}},
+	{Red: Alliance{Teams: []string{"a", "c"}, Score: 15}, Blue: Alliance{Teams: []string{"b"}, Score: 20}},
+	{Red: Alliance{Teams: []string{"b", "c"}, Score: 25}, Blue: Alliance{Teams: []string{"a"}, Score: 10}},
+}
+
+func TestCompute(t *testing.T) {
+	r, err := Compute(threeTeams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][3]float64{
+		"a": {10, 11, -1},
+		"b": {20, 1, 19},
+		"c": {5, 16, -11},
+	}
+	for team, w := range want {
+		if got := r.OPR[team]; !near(got, w[0]) {
+			t.Errorf("OPR[%s] = %g, want %g", team, got, w[0])
+		}
+		if got := r.DPR[team]; !near(got, w[1]) {
+			t.Errorf("DPR[%s] = %g, want %g", team, got, w[1])
+		}
+		if got := r.CCWM[team]; !near(got, w[2]) {
+			t.Errorf("CCWM[%s] = %g, want %g", team, got, w[2])
+		}
+	}
+	if len(r.Teams) != 3 || r.Teams[0] != "a" || r.Teams[2] != "c" {
+		t.Errorf("Teams = %v, want [a b c]", r.Teams)
+	}
+}
+
+func TestComputeNoMatches(t *testing.T) {
+	if _, err := Compute(nil); err != ErrNoMatches {
+		t.Errorf("Compute(nil) error = %v, want ErrNoMatches", err)
+	}
+	if _, err := Component(nil, "autoPoints"); err != ErrNoMatches {
+		t.Errorf("Component(nil) error = %v, want ErrNoMatches", err)
+	}
+}
+
+func TestCholeskySolve(t *testing.T) {
+	// [4 2; 2 3] x = [2 1] has the solution x = [0.5 0].
+	x, err := choleskySolve([][]float64{{4, 2}, {2, 3}}, []float64{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(x[0], 0.5) || !near(x[1], 0) {
+		t.Errorf("x = %v, want [0.5 0]", x)
+	}
+
+	if _, err = choleskySolve([][]float64{{1, 2}, {2, 1}}, []float64{1, 1}); err == nil {
+		t.Error("solving an indefinite matrix didn't fail")
+	}
+}
+
+func TestFields(t *testing.T) {
+	matches := []Match{
+		{Red: Alliance{Values: map[string]float64{"auto": 1, "endgame": 2}}, Blue: Alliance{Values: map[string]float64{"auto": 3, "endgame": 0}}},
+		{Red: Alliance{Values: map[string]float64{"endgame": 1, "auto": 0}}, Blue: Alliance{Values: map[string]float64{"auto": 2, "fouls": 5}}},
+	}
+	// endgame and fouls are missing from an alliance, so can't be solved.
+	if got := Fields(matches); len(got) != 1 || got[0] != "auto" {
+		t.Errorf("Fields = %v, want [auto]", got)
+	}
+	if got := Fields(nil); len(got) != 0 {
+		t.Errorf("Fields(nil) = %v, want none", got)
+	}
+}
+
+func TestLast(t *testing.T) {
+	match := func(red, blue string) Match {
+		return Match{Red: Alliance{Teams: []string{red}}, Blue: Alliance{Teams: []string{blue}}}
+	}
+	matches := []Match{
+		match("a", "b"),
+		match("a", "c"),
+		match("b", "c"),
+		match("a", "b"),
+	}
+
+	// a and b have both played twice since the first match, so only it is
+	// dropped.
+	want := []Match{matches[1], matches[2], matches[3]}
+	if got := Last(matches, 2); !sameMatches(got, want) {
+		t.Errorf("Last(2) = %v, want %v", got, want)
+	}
+	if got := Last(matches, 1); !sameMatches(got, []Match{matches[2], matches[3]}) {
+		t.Errorf("Last(1) = %v, want the last two matches", got)
+	}
+	if got := Last(matches, 10); !sameMatches(got, matches) {
+		t.Errorf("Last(10) = %v, want every match", got)
+	}
+	if got := Last(matches, 0); len(got) != 0 {
+		t.Errorf("Last(0) = %v, want none", got)
+	}
+}
+
+func sameMatches(a, b []Match) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Red.Teams[0] != b[i].Red.Teams[0] || a[i].Blue.Teams[0] != b[i].Blue.Teams[0] {
+			return false
+		}
+	}
+	return true
+}
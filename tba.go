@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const tbaBaseURL = "https://www.thebluealliance.com/api/v3"
+
+var errTBANotFound = errors.New("not found on TBA")
+
+type tbaTeam struct {
+	Key        string `json:"key"`
+	TeamNumber int    `json:"team_number"`
+	Nickname   string `json:"nickname"`
+	Name       string `json:"name"`
+	SchoolName string `json:"school_name"`
+	City       string `json:"city"`
+	StateProv  string `json:"state_prov"`
+	Country    string `json:"country"`
+	Website    string `json:"website"`
+	RookieYear int    `json:"rookie_year"`
+	Motto      string `json:"motto"`
+}
+
+type tbaRobot struct {
+	Year      int    `json:"year"`
+	RobotName string `json:"robot_name"`
+	Key       string `json:"key"`
+	TeamKey   string `json:"team_key"`
+}
+
+type tbaAwardRecipient struct {
+	TeamKey string `json:"team_key"`
+	Awardee string `json:"awardee"`
+}
+
+type tbaAward struct {
+	Name          string              `json:"name"`
+	AwardType     int                 `json:"award_type"`
+	EventKey      string              `json:"event_key"`
+	RecipientList []tbaAwardRecipient `json:"recipient_list"`
+	Year          int                 `json:"year"`
+}
+
+type tbaMedia struct {
+	Type       string `json:"type"`
+	ForeignKey string `json:"foreign_key"`
+	Preferred  bool   `json:"preferred"`
+}
+
+// Award types from TBA's AwardType enum.
+const (
+	awardChairmans              = 0
+	awardWinner                 = 1
+	awardFinalist               = 2
+	awardWoodieFlowers          = 3
+	awardDeansList              = 4
+	awardVolunteer              = 5
+	awardFounders               = 6
+	awardBartKamen              = 7
+	awardMakeItLoud             = 8
+	awardEngineeringInspiration = 9
+	awardRookieAllStar          = 10
+	awardChairmansFinalist      = 69
+)
+
+// blueBannerAwards are the team awards that come with a blue banner.
+var blueBannerAwards = map[int]bool{
+	awardChairmans:         true,
+	awardWinner:            true,
+	awardChairmansFinalist: true,
+}
+
+// tbaGet fetches a TBA API path such as /team/frc254 and decodes the JSON
+// response into v.
+func tbaGet(path string, v interface{}) error {
+	data, err := makeRequest(http.MethodGet, tbaBaseURL+path)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(data, []byte("null")) || bytes.HasPrefix(data, []byte(`{"Errors"`)) {
+		return errTBANotFound
+	}
+
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %v", path, err)
+	}
+	return nil
+}
+
+func teamKey(team string) string {
+	return "frc" + team
+}
+
+func tbaTeamInfo(team string) (*tbaTeam, error) {
+	var t tbaTeam
+	err := tbaGet("/team/"+teamKey(team), &t)
+	return &t, err
+}
+
+func tbaTeamYears(team string) ([]int, error) {
+	var years []int
+	err := tbaGet("/team/"+teamKey(team)+"/years_participated", &years)
+	return years, err
+}
+
+func tbaTeamRobots(team string) ([]tbaRobot, error) {
+	var robots []tbaRobot
+	err := tbaGet("/team/"+teamKey(team)+"/robots", &robots)
+	return robots, err
+}
+
+func tbaTeamAwards(team string) ([]tbaAward, error) {
+	var awards []tbaAward
+	err := tbaGet("/team/"+teamKey(team)+"/awards", &awards)
+	return awards, err
+}
+
+func tbaTeamYearAwards(team string, year int) ([]tbaAward, error) {
+	var awards []tbaAward
+	err := tbaGet(fmt.Sprintf("/team/%s/awards/%d", teamKey(team), year), &awards)
+	return awards, err
+}
+
+func tbaTeamEvents(team string, year int) ([]tbaEvent, error) {
+	var events []tbaEvent
+	err := tbaGet(fmt.Sprintf("/team/%s/events/%d/simple", teamKey(team), year), &events)
+	return events, err
+}
+
+func tbaTeamSocialMedia(team string) ([]tbaMedia, error) {
+	var media []tbaMedia
+	err := tbaGet("/team/"+teamKey(team)+"/social_media", &media)
+	return media, err
+}
+
+// url returns a link for social media types TBA knows about, or "".
+func (m tbaMedia) url() string {
+	switch m.Type {
+	case "facebook-profile":
+		return "https://www.facebook.com/" + m.ForeignKey
+	case "twitter-profile":
+		return "https://twitter.com/" + m.ForeignKey
+	case "youtube-channel":
+		return "https://www.youtube.com/" + m.ForeignKey
+	case "github-profile":
+		return "https://github.com/" + m.ForeignKey
+	case "instagram-profile":
+		return "https://www.instagram.com/" + m.ForeignKey
+	}
+	return ""
+}
+
+type tbaDistrict struct {
+	Abbreviation string `json:"abbreviation"`
+	DisplayName  string `json:"display_name"`
+	Key          string `json:"key"`
+	Year         int    `json:"year"`
+}
+
+type tbaWebcast struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	File    string `json:"file"`
+}
+
+type tbaEvent struct {
+	Key             string       `json:"key"`
+	Name            string       `json:"name"`
+	ShortName       string       `json:"short_name"`
+	EventCode       string       `json:"event_code"`
+	EventType       int          `json:"event_type"`
+	EventTypeString string       `json:"event_type_string"`
+	District        *tbaDistrict `json:"district"`
+	City            string       `json:"city"`
+	StateProv       string       `json:"state_prov"`
+	Country         string       `json:"country"`
+	StartDate       string       `json:"start_date"`
+	EndDate         string       `json:"end_date"`
+	Year            int          `json:"year"`
+	Week            *int         `json:"week"`
+	Timezone        string       `json:"timezone"`
+	Website         string       `json:"website"`
+	Webcasts        []tbaWebcast `json:"webcasts"`
+	PlayoffType     *int         `json:"playoff_type"`
+}
+
+type tbaRecord struct {
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Ties   int `json:"ties"`
+}
+
+type tbaRanking struct {
+	Rank          int        `json:"rank"`
+	TeamKey       string     `json:"team_key"`
+	Record        *tbaRecord `json:"record"`
+	SortOrders    []float64  `json:"sort_orders"`
+	MatchesPlayed int        `json:"matches_played"`
+	Dq            int        `json:"dq"`
+}
+
+type tbaSortOrderInfo struct {
+	Name      string `json:"name"`
+	Precision int    `json:"precision"`
+}
+
+type tbaRankings struct {
+	Rankings      []tbaRanking       `json:"rankings"`
+	SortOrderInfo []tbaSortOrderInfo `json:"sort_order_info"`
+}
+
+type tbaAlliance struct {
+	Name     string   `json:"name"`
+	Picks    []string `json:"picks"`
+	Declines []string `json:"declines"`
+	Status   *struct {
+		Status          string `json:"status"`
+		Level           string `json:"level"`
+		DoubleElimRound string `json:"double_elim_round"`
+	} `json:"status"`
+}
+
+type tbaMatchAlliance struct {
+	Score             int      `json:"score"`
+	TeamKeys          []string `json:"team_keys"`
+	SurrogateTeamKeys []string `json:"surrogate_team_keys"`
+	DqTeamKeys        []string `json:"dq_team_keys"`
+}
+
+type tbaVideo struct {
+	Type string `json:"type"`
+	Key  string `json:"key"`
+}
+
+type tbaMatch struct {
+	Key             string                            `json:"key"`
+	CompLevel       string                            `json:"comp_level"`
+	SetNumber       int                               `json:"set_number"`
+	MatchNumber     int                               `json:"match_number"`
+	Alliances       map[string]*tbaMatchAlliance      `json:"alliances"`
+	WinningAlliance string                            `json:"winning_alliance"`
+	EventKey        string                            `json:"event_key"`
+	Time            int64                             `json:"time"`
+	ActualTime      int64                             `json:"actual_time"`
+	PredictedTime   int64                             `json:"predicted_time"`
+	PostResultTime  int64                             `json:"post_result_time"`
+	ScoreBreakdown  map[string]map[string]interface{} `json:"score_breakdown"`
+	Videos          []tbaVideo                        `json:"videos"`
+}
+
+// played reports whether a match has a result. TBA uses -1 for scores of
+// matches that haven't been played.
+func (m *tbaMatch) played() bool {
+	return m.Alliances["red"] != nil && m.Alliances["red"].Score >= 0 &&
+		m.Alliances["blue"] != nil && m.Alliances["blue"].Score >= 0
+}
+
+func (e *tbaEvent) location() string {
+	var parts []string
+	for _, part := range []string{e.City, e.StateProv, e.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func tbaEventInfo(event string) (*tbaEvent, error) {
+	var e tbaEvent
+	err := tbaGet("/event/"+event, &e)
+	return &e, err
+}
+
+func tbaEventRankings(event string) (*tbaRankings, error) {
+	var r tbaRankings
+	err := tbaGet("/event/"+event+"/rankings", &r)
+	return &r, err
+}
+
+func tbaEventAlliances(event string) ([]tbaAlliance, error) {
+	var alliances []tbaAlliance
+	err := tbaGet("/event/"+event+"/alliances", &alliances)
+	return alliances, err
+}
+
+func tbaEventAwards(event string) ([]tbaAward, error) {
+	var awards []tbaAward
+	err := tbaGet("/event/"+event+"/awards", &awards)
+	return awards, err
+}
+
+func tbaEventMatches(event string) ([]tbaMatch, error) {
+	var matches []tbaMatch
+	err := tbaGet("/event/"+event+"/matches", &matches)
+	return matches, err
+}
+
+func tbaEventTeamKeys(event string) ([]string, error) {
+	var keys []string
+	err := tbaGet("/event/"+event+"/teams/keys", &keys)
+	return keys, err
+}
+
+// ignoreNotFound treats a missing TBA resource as empty. TBA returns null for
+// rankings, alliances and the like before an event has them.
+func ignoreNotFound(err error) error {
+	if err == errTBANotFound {
+		return nil
+	}
+	return err
+}
+
+func tbaMatchInfo(match string) (*tbaMatch, error) {
+	var m tbaMatch
+	err := tbaGet("/match/"+match, &m)
+	return &m, err
+}
+
+func tbaTeamMatches(team string, year int) ([]tbaMatch, error) {
+	var matches []tbaMatch
+	err := tbaGet(fmt.Sprintf("/team/%s/matches/%d", teamKey(team), year), &matches)
+	return matches, err
+}
+
+func tbaTeamEventMatches(team, event string) ([]tbaMatch, error) {
+	var matches []tbaMatch
+	err := tbaGet("/team/"+teamKey(team)+"/event/"+event+"/matches", &matches)
+	return matches, err
+}
+
+// allianceOf returns "red" or "blue" for the alliance teamKey played on, or
+// "" if the team wasn't in the match.
+func (m *tbaMatch) allianceOf(teamKey string) string {
+	for color, alliance := range m.Alliances {
+		for _, key := range alliance.TeamKeys {
+			if key == teamKey {
+				return color
+			}
+		}
+	}
+	return ""
+}
+
+// outcome returns W, L or T for the given alliance color of a played match.
+func (m *tbaMatch) outcome(color string) string {
+	switch m.WinningAlliance {
+	case "":
+		return "T"
+	case color:
+		return "W"
+	}
+	return "L"
+}
+
+func opponent(color string) string {
+	if color == "red" {
+		return "blue"
+	}
+	return "red"
+}
+
+func tbaEventsSimple(year int) ([]tbaEvent, error) {
+	var events []tbaEvent
+	err := tbaGet(fmt.Sprintf("/events/%d/simple", year), &events)
+	return events, err
+}
+
+func tbaEvents(year int) ([]tbaEvent, error) {
+	var events []tbaEvent
+	err := tbaGet(fmt.Sprintf("/events/%d", year), &events)
+	return events, err
+}
+
+func tbaDistrictTeamKeys(district string) ([]string, error) {
+	var keys []string
+	err := tbaGet("/district/"+district+"/teams/keys", &keys)
+	return keys, err
+}
+
+type tbaDistrictEventPoints struct {
+	EventKey       string `json:"event_key"`
+	DistrictCmp    bool   `json:"district_cmp"`
+	QualPoints     int    `json:"qual_points"`
+	AlliancePoints int    `json:"alliance_points"`
+	ElimPoints     int    `json:"elim_points"`
+	AwardPoints    int    `json:"award_points"`
+	Total          int    `json:"total"`
+}
+
+type tbaDistrictRanking struct {
+	TeamKey     string                   `json:"team_key"`
+	Rank        int                      `json:"rank"`
+	RookieBonus int                      `json:"rookie_bonus"`
+	PointTotal  int                      `json:"point_total"`
+	EventPoints []tbaDistrictEventPoints `json:"event_points"`
+}
+
+func tbaDistrictRankings(district string) ([]tbaDistrictRanking, error) {
+	var rankings []tbaDistrictRanking
+	err := tbaGet("/district/"+district+"/rankings", &rankings)
+	return rankings, err
+}
+
+func tbaDistrictEvents(district string) ([]tbaEvent, error) {
+	var events []tbaEvent
+	err := tbaGet("/district/"+district+"/events/simple", &events)
+	return events, err
+}
+
+func tbaTeamDistricts(team string) ([]tbaDistrict, error) {
+	var districts []tbaDistrict
+	err := tbaGet("/team/"+teamKey(team)+"/districts", &districts)
+	return districts, err
+}
+
+// official reports whether an event counts towards ratings: regionals,
+// districts and championships, but not offseason or preseason events.
+func (e *tbaEvent) official() bool {
+	return e.EventType >= 0 && e.EventType <= 5
+}
+
+func (e *tbaEvent) dates() (start, end time.Time) {
+	start, _ = time.Parse(tbaDateFmt, e.StartDate)
+	end, _ = time.Parse(tbaDateFmt, e.EndDate)
+	return start, end
+}
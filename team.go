@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	tbaColor      = 0x3f51b5
+	awardsPerPage = 15
+)
+
+// isChampionship guesses from the event key whether an award was given at the
+// FIRST Championship, where Chairman's winners join the Hall of Fame.
+func isChampionship(eventKey string) bool {
+	return len(eventKey) > 4 && strings.HasPrefix(eventKey[4:], "cmp")
+}
+
+func teamLocation(t *tbaTeam) string {
+	var parts []string
+	for _, part := range []string{t.City, t.StateProv, t.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func teamCommand(ctx *commandContext) error {
+	team := ctx.str("team")
+
+	info, err := tbaTeamInfo(team)
+	if err == errTBANotFound {
+		return commandError(fmt.Sprintf("TBA doesn't know about team %s.", team))
+	}
+	if err != nil {
+		return err
+	}
+
+	years, err := tbaTeamYears(team)
+	if err != nil {
+		return err
+	}
+	robots, err := tbaTeamRobots(team)
+	if err != nil {
+		return err
+	}
+	awards, err := tbaTeamAwards(team)
+	if err != nil {
+		return err
+	}
+	media, err := tbaTeamSocialMedia(team)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(awards, func(i, j int) bool {
+		if awards[i].Year != awards[j].Year {
+			return awards[i].Year > awards[j].Year
+		}
+		return awards[i].EventKey < awards[j].EventKey
+	})
+	sort.Slice(robots, func(i, j int) bool { return robots[i].Year > robots[j].Year })
+
+	title := fmt.Sprintf("Team %d", info.TeamNumber)
+	if info.Nickname != "" {
+		title += " - " + info.Nickname
+	}
+	url := "https://www.thebluealliance.com/team/" + team
+
+	profile := &discordgo.MessageEmbed{
+		Title:       title,
+		URL:         url,
+		Color:       tbaColor,
+		Description: info.Motto,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Location", Value: orNone(teamLocation(info)), Inline: true},
+			{Name: "Rookie year", Value: fmt.Sprintf("%d", info.RookieYear), Inline: true},
+			{Name: "Seasons", Value: fmt.Sprintf("%d", len(years)), Inline: true},
+		},
+	}
+	if info.SchoolName != "" {
+		profile.Fields = append(profile.Fields, &discordgo.MessageEmbedField{Name: "School", Value: info.SchoolName})
+	}
+
+	banners := 0
+	var chairmans []string
+	for _, award := range awards {
+		if blueBannerAwards[award.AwardType] {
+			banners++
+		}
+		switch {
+		case award.AwardType == awardChairmans && isChampionship(award.EventKey):
+			chairmans = append(chairmans, fmt.Sprintf("**%d Hall of Fame**", award.Year))
+		case award.AwardType == awardChairmans || award.AwardType == awardChairmansFinalist:
+			chairmans = append(chairmans, fmt.Sprintf("%d %s (%s)", award.Year, award.Name, award.EventKey))
+		}
+	}
+	profile.Fields = append(profile.Fields,
+		&discordgo.MessageEmbedField{Name: "Blue banners", Value: fmt.Sprintf("%d", banners), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Awards", Value: fmt.Sprintf("%d", len(awards)), Inline: true},
+	)
+	if len(chairmans) > 0 {
+		profile.Fields = append(profile.Fields, &discordgo.MessageEmbedField{
+			Name:  "Chairman's / Impact",
+			Value: truncate(strings.Join(chairmans, "\n"), 1024),
+		})
+	}
+
+	var robotNames []string
+	for _, robot := range robots {
+		robotNames = append(robotNames, fmt.Sprintf("%d: %s", robot.Year, robot.RobotName))
+	}
+	if len(robotNames) > 0 {
+		profile.Fields = append(profile.Fields, &discordgo.MessageEmbedField{
+			Name:  "Robots",
+			Value: truncate(strings.Join(robotNames, "\n"), 1024),
+		})
+	}
+
+	links := []string{"[The Blue Alliance](" + url + ")"}
+	if info.Website != "" {
+		links = append(links, "[Website]("+info.Website+")")
+	}
+	for _, m := range media {
+		if u := m.url(); u != "" {
+			links = append(links, fmt.Sprintf("[%s](%s)", strings.Split(m.Type, "-")[0], u))
+		}
+	}
+	profile.Fields = append(profile.Fields, &discordgo.MessageEmbedField{Name: "Links", Value: strings.Join(links, " • ")})
+
+	pages := []*discordgo.MessageEmbed{profile}
+	for start := 0; start < len(awards); start += awardsPerPage {
+		end := start + awardsPerPage
+		if end > len(awards) {
+			end = len(awards)
+		}
+
+		var lines []string
+		for _, award := range awards[start:end] {
+			lines = append(lines, fmt.Sprintf("%d **%s** (%s)", award.Year, award.Name, award.EventKey))
+		}
+		pages = append(pages, &discordgo.MessageEmbed{
+			Title:       title + " awards",
+			URL:         url,
+			Color:       tbaColor,
+			Description: strings.Join(lines, "\n"),
+		})
+	}
+
+	_, err = ctx.replyPages(pages)
+	return err
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// truncate cuts s to at most n bytes on a line boundary so it fits in an
+// embed field.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n-4]
+	if i := strings.LastIndex(s, "\n"); i > 0 {
+		s = s[:i]
+	}
+	return s + "\n..."
+}
+
+func init() {
+	registerCommand(&command{
+		name:    "team",
+		aliases: []string{"t"},
+		summary: "Show a team's profile, robots and awards from TBA.",
+		args:    []argSpec{{name: "team", kind: argTeam}},
+		run:     teamCommand,
+	})
+}